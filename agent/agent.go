@@ -2,23 +2,37 @@ package agent
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/ttacon/glorious/config"
 	"github.com/ttacon/glorious/context"
+	"github.com/ttacon/glorious/provider"
+	"github.com/ttacon/glorious/scheduler"
+	"github.com/ttacon/glorious/unit"
 )
 
 type Agent struct {
+	// confMux guards conf, which is replaced when the config is reloaded.
+	confMux *sync.RWMutex
 	conf    *config.GloriousConfig
 	fileLoc string
 	lgr     context.Logger
+
+	operationsMux *sync.Mutex
+	operations    map[string]*operation
 }
 
 func NewAgent(conf *config.GloriousConfig, fileLoc string, lgr context.Logger) *Agent {
 	return &Agent{
+		confMux: new(sync.RWMutex),
 		conf:    conf,
 		fileLoc: fileLoc,
 		lgr:     lgr,
+
+		operationsMux: new(sync.Mutex),
+		operations:    make(map[string]*operation),
 	}
 }
 
@@ -32,8 +46,9 @@ func (a *Agent) Greet(params []string, reply *string) error {
 func (a *Agent) Config(_ struct{}, units *[]UnitConfig) error {
 	debugRemoteCallStart(a.lgr, "Config")
 
-	*units = make([]UnitConfig, len(a.conf.Units))
-	for i, unit := range a.conf.Units {
+	conf := a.Conf()
+	*units = make([]UnitConfig, len(conf.Units))
+	for i, unit := range conf.Units {
 		(*units)[i] = UnitConfig{
 			Name:        unit.Name,
 			NumSlots:    len(unit.Slots),
@@ -47,29 +62,91 @@ func (a *Agent) Config(_ struct{}, units *[]UnitConfig) error {
 func (a *Agent) Status(_ struct{}, units *[]UnitStatus) error {
 	debugRemoteCallStart(a.lgr, "Status")
 
-	*units = make([]UnitStatus, len(a.conf.Units))
-	for i, unit := range a.conf.Units {
+	conf := a.Conf()
+	*units = make([]UnitStatus, len(conf.Units))
+	for i, unit := range conf.Units {
 		(*units)[i] = UnitStatus{
 			Name:   unit.Name,
 			Groups: unit.Groups,
 			Status: unit.ProcessStatus(),
 		}
+		if stat := unit.GetStatus(); stat != nil {
+			updateAvailable := stat.UpdateAvailable()
+
+			stat.Lock()
+			(*units)[i].Details = stat.HealthErr
+			if updateAvailable {
+				(*units)[i].Details = joinDetails((*units)[i].Details, "update available")
+			}
+			(*units)[i].Restarts = stat.Restarts
+			if stat.Exited {
+				(*units)[i].ExitCode = strconv.Itoa(stat.ExitCode)
+			}
+			stat.Unlock()
+		}
 	}
 
 	return nil
 }
 
-func (a *Agent) Reload(_ struct{}, err *error) error {
+// joinDetails adds detail to the details that are already shown for a unit.
+func joinDetails(details, detail string) string {
+	if len(details) == 0 {
+		return detail
+	}
+	return details + "; " + detail
+}
+
+func (a *Agent) Reload(_ struct{}, resp *ErrResponse) error {
 	debugRemoteCallStart(a.lgr, "Reload")
 
-	a.conf, *err = config.LoadConfig(a.fileLoc)
+	conf, err := config.LoadConfig(a.fileLoc)
+	if err != nil {
+		resp.Err = err.Error()
+		return nil
+	}
+
+	// Keep running with the old config if the new one isn't valid.
+	if errs := conf.Validate(); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		resp.Err = strings.Join(msgs, "\n")
+		return nil
+	}
+
+	a.confMux.Lock()
+	defer a.confMux.Unlock()
+
+	// Units that are still in the config carry on from where they were,
+	// rather than being found again by their drivers.
+	conf.SetContext(a.conf.GetContext())
+	for _, u := range conf.Units {
+		if prev, exists := a.conf.GetUnit(u.Name); exists {
+			u.CarryOver(prev)
+		}
+	}
+	if err := conf.Init(); err != nil {
+		resp.Err = err.Error()
+		return nil
+	}
+
+	// Only the new units may restart anything from now on, otherwise a
+	// unit could be restarted by its old self after it's been stopped.
+	for _, prev := range a.conf.Units {
+		next, _ := conf.GetUnit(prev.Name)
+		prev.Retire(next)
+	}
+
+	a.conf = conf
 	return nil
 }
 
 func (a *Agent) StartUnit(unitName string, err *string) error {
 	debugRemoteCallStart(a.lgr, "StartUnit")
 
-	unit, exists := a.conf.GetUnit(unitName)
+	unit, exists := a.Conf().GetUnit(unitName)
 	if !exists {
 		*err = "unknown unit"
 		return nil
@@ -84,7 +161,7 @@ func (a *Agent) StartUnit(unitName string, err *string) error {
 func (a *Agent) StopUnit(unitName string, err *string) error {
 	debugRemoteCallStart(a.lgr, "StopUnit")
 
-	unit, exists := a.conf.GetUnit(unitName)
+	unit, exists := a.Conf().GetUnit(unitName)
 	if !exists {
 		*err = "unknown unit"
 		return nil
@@ -96,10 +173,93 @@ func (a *Agent) StopUnit(unitName string, err *string) error {
 	return nil
 }
 
+// StartUnits starts the given units and groups, along with their
+// dependencies, in the background. Independent units are started at the same
+// time, up to the requested or configured concurrency. The returned
+// operation can be polled with Progress.
+func (a *Agent) StartUnits(req StartUnitsRequest, resp *StartUnitsResponse) error {
+	debugRemoteCallStart(a.lgr, "StartUnits")
+
+	conf := a.Conf()
+	units, err := conf.GetUnits(req.Names)
+	if err != nil {
+		resp.Err = err.Error()
+		return nil
+	}
+
+	opts := scheduler.Options{
+		Concurrency:   req.Concurrency,
+		ForceRecreate: req.ForceRecreate,
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = conf.Concurrency
+	}
+
+	id, op := a.newOperation()
+	go func() {
+		op.finish(scheduler.Start(units, opts, op.report))
+	}()
+
+	resp.OperationID = id
+	return nil
+}
+
+type StartUnitsRequest struct {
+	Names []string
+
+	// Concurrency overrides the configured concurrency if set.
+	Concurrency int
+
+	// ForceRecreate starts units again even if they're already running
+	// and up to date.
+	ForceRecreate bool
+}
+
+type StartUnitsResponse struct {
+	OperationID string
+	Err         string
+}
+
+// StopUnits stops the given units and groups, stopping units before the
+// units they depend on.
+func (a *Agent) StopUnits(req UnitsRequest, resp *UnitsResponse) error {
+	debugRemoteCallStart(a.lgr, "StopUnits")
+
+	units, err := a.Conf().GetUnits(req.Names)
+	if err != nil {
+		resp.Err = err.Error()
+		return nil
+	}
+
+	for _, u := range unit.StopOrder(units) {
+		result := UnitResult{Name: u.Name}
+		if stopErr := u.Stop(); stopErr != nil {
+			result.Err = stopErr.Error()
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	return nil
+}
+
+type UnitsRequest struct {
+	Names []string
+}
+
+type UnitsResponse struct {
+	Results []UnitResult
+	Err     string
+}
+
+type UnitResult struct {
+	Name string
+	Err  string
+}
+
 func (a *Agent) StorePutValue(req StorePutValueRequest, resp *ErrResponse) error {
 	debugRemoteCallStart(a.lgr, "StorePutValue")
 
-	store := a.conf.GetContext().InternalStore()
+	store := a.Conf().GetContext().InternalStore()
 	if err := store.PutInternalStoreVal(req.Key, req.Value); err != nil {
 		resp.Err = err.Error()
 	}
@@ -111,12 +271,14 @@ func (a *Agent) Logger() context.Logger {
 }
 
 func (a *Agent) Conf() *config.GloriousConfig {
+	a.confMux.RLock()
+	defer a.confMux.RUnlock()
+
 	return a.conf
 }
 
-func (a *Agent) ExchangeTailToken(token string) ([]string, bool) {
-	names, ok := a.conf.ExchangeTailToken(token)
-	return names, ok
+func (a *Agent) ExchangeTailToken(token string) ([]string, provider.LogOptions, bool) {
+	return a.Conf().ExchangeTailToken(token)
 }
 
 type StorePutValueRequest struct {
@@ -131,7 +293,7 @@ type ErrResponse struct {
 func (a *Agent) StoreGetValues(req *StoreGetValuesRequest, resp *StoreGetValuesResponse) error {
 	debugRemoteCallStart(a.lgr, "StoreGetValue")
 
-	store := a.conf.GetContext().InternalStore()
+	store := a.Conf().GetContext().InternalStore()
 
 	resp.Values = make(map[string]string)
 	for _, key := range req.Keys {
@@ -152,12 +314,32 @@ func (a *Agent) TailProcesses(req *TailProcessesRequest, resp *TailProcessesResp
 		return nil
 	}
 
-	// Validate all names are valid units
-	var invalidNames []string
+	// Validate all names are valid units or groups, expanding groups
+	// into their units as we go.
+	conf := a.Conf()
+	var (
+		names        []string
+		seen         = make(map[string]bool)
+		invalidNames []string
+	)
 	for _, name := range req.Names {
-		_, exists := a.conf.GetUnit(name)
+		units, exists := conf.GetGroup(name)
+		if !exists {
+			var u *unit.Unit
+			if u, exists = conf.GetUnit(name); exists {
+				units = []*unit.Unit{u}
+			}
+		}
 		if !exists {
 			invalidNames = append(invalidNames, name)
+			continue
+		}
+
+		for _, u := range units {
+			if !seen[u.Name] {
+				seen[u.Name] = true
+				names = append(names, u.Name)
+			}
 		}
 	}
 	if len(invalidNames) > 0 {
@@ -168,16 +350,28 @@ func (a *Agent) TailProcesses(req *TailProcessesRequest, resp *TailProcessesResp
 		return nil
 	}
 
-	resp.Token = a.conf.CreateTailProcessToken(req.Names)
+	resp.Names = names
+	resp.Token = conf.CreateTailProcessToken(names, provider.LogOptions{
+		Lines:  req.Lines,
+		Follow: req.Follow,
+		Since:  req.Since,
+	})
 	return nil
 }
 
 type TailProcessesRequest struct {
 	Names []string
+
+	// Lines is the number of existing lines to send for each unit, a
+	// value of zero sends all of them.
+	Lines  int
+	Follow bool
+	Since  string
 }
 
 type TailProcessesResponse struct {
 	Token string
+	Names []string
 	Err   string
 }
 
@@ -196,9 +390,15 @@ type UnitConfig struct {
 }
 
 type UnitStatus struct {
-	Name   string   `json:"name"`
-	Groups []string `json:"groups"`
-	Status string   `json:"status"`
+	Name    string   `json:"name"`
+	Groups  []string `json:"groups"`
+	Status  string   `json:"status"`
+	Details string   `json:"details"`
+
+	Restarts int `json:"restarts"`
+
+	// ExitCode is the last exit code of the unit, if it has exited.
+	ExitCode string `json:"exitCode"`
 }
 
 func debugRemoteCallStart(lgr context.Logger, action string) {
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/satori/go.uuid"
+	"github.com/ttacon/glorious/scheduler"
+)
+
+// operation tracks the progress of a long running request, such as
+// starting units, so that clients can poll for it.
+type operation struct {
+	mux    *sync.Mutex
+	events []scheduler.Event
+	done   bool
+	err    string
+}
+
+func (o *operation) report(e scheduler.Event) {
+	o.mux.Lock()
+	o.events = append(o.events, e)
+	o.mux.Unlock()
+}
+
+func (o *operation) finish(err error) {
+	o.mux.Lock()
+	o.done = true
+	if err != nil {
+		o.err = err.Error()
+	}
+	o.mux.Unlock()
+}
+
+func (a *Agent) newOperation() (string, *operation) {
+	op := &operation{mux: new(sync.Mutex)}
+	id := uuid.NewV4().String()
+
+	a.operationsMux.Lock()
+	a.operations[id] = op
+	a.operationsMux.Unlock()
+
+	return id, op
+}
+
+// Progress returns the events of an operation from the given offset. Once
+// an operation is done and all of its events have been returned, it is
+// forgotten.
+func (a *Agent) Progress(req ProgressRequest, resp *ProgressResponse) error {
+	a.operationsMux.Lock()
+	op, exists := a.operations[req.ID]
+	a.operationsMux.Unlock()
+
+	if !exists {
+		resp.Err = "unknown operation"
+		return nil
+	}
+
+	op.mux.Lock()
+	if req.Offset < len(op.events) {
+		resp.Events = append(resp.Events, op.events[req.Offset:]...)
+	}
+	resp.Done = op.done
+	resp.OperationErr = op.err
+	op.mux.Unlock()
+
+	if resp.Done {
+		a.operationsMux.Lock()
+		delete(a.operations, req.ID)
+		a.operationsMux.Unlock()
+	}
+
+	return nil
+}
+
+type ProgressRequest struct {
+	ID string
+
+	// Offset is the number of events that have already been seen.
+	Offset int
+}
+
+type ProgressResponse struct {
+	Events []scheduler.Event
+	Done   bool
+
+	// OperationErr is set if the operation itself failed, Err is set if
+	// its progress couldn't be retrieved.
+	OperationErr string
+	Err          string
+}
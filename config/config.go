@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -10,6 +11,8 @@ import (
 	"github.com/satori/go.uuid"
 	gcontext "github.com/ttacon/glorious/context"
 	gerrors "github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/provider"
+	"github.com/ttacon/glorious/slot"
 	"github.com/ttacon/glorious/unit"
 )
 
@@ -19,7 +22,24 @@ func LoadConfig(configFileLocation string) (*GloriousConfig, error) {
 		return nil, err
 	}
 
-	return ParseConfigRaw(data)
+	m, err := ParseConfigRaw(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Paths in the config are relative to the config file, not to
+	// wherever we happen to be run from.
+	dir, err := filepath.Abs(filepath.Dir(configFileLocation))
+	if err != nil {
+		return nil, err
+	}
+	if err := m.ResolvePaths(dir); err != nil {
+		return nil, err
+	}
+	if len(m.Project) == 0 {
+		m.project.Name = provider.ProjectName(filepath.Base(dir))
+	}
+	return m, nil
 }
 
 func ParseConfig(str string) (*GloriousConfig, error) {
@@ -49,25 +69,53 @@ func ParseConfigRaw(data []byte) (*GloriousConfig, error) {
 			}
 		}
 
-		if len(unit.DependsOnRaw) > 0 {
+		if len(unit.DependsOnRaw) > 0 || len(unit.Dependencies) > 0 {
 			dependenciesToProcess = append(dependenciesToProcess, unit)
 		}
 	}
 
-	for _, unit := range dependenciesToProcess {
-		for _, dep := range unit.DependsOnRaw {
-			identifiedUnit, dependencyExists := (&m).GetUnit(dep)
+	for _, u := range dependenciesToProcess {
+		// Plain depends_on entries are the same as a dependency block
+		// without a condition, the blocks win if both are given.
+		declared := make(map[string]bool)
+		for _, dep := range u.Dependencies {
+			declared[dep.Name] = true
+		}
+		for _, name := range u.DependsOnRaw {
+			if !declared[name] {
+				declared[name] = true
+				u.Dependencies = append(u.Dependencies, &unit.Dependency{
+					Name: name,
+				})
+			}
+		}
+
+		for _, dep := range u.Dependencies {
+			identifiedUnit, dependencyExists := (&m).GetUnit(dep.Name)
 			if !dependencyExists {
 				return nil, fmt.Errorf(
 					"invalid dependency %q for unit %q",
-					dep,
-					unit.Name,
+					dep.Name,
+					u.Name,
 				)
 			}
-			unit.DependsOn = append(unit.DependsOn, identifiedUnit)
+			dep.Unit = identifiedUnit
+			u.DependsOn = append(u.DependsOn, identifiedUnit)
 		}
 	}
 
+	if m.Network == nil {
+		m.Network = &provider.Network{}
+	}
+	m.project = &provider.Project{
+		Name:    provider.ProjectName(m.Project),
+		Network: m.Network,
+	}
+	(&m).eachSlot(func(_ *unit.Unit, s *slot.Slot) error {
+		s.Provider.SetProject(m.project, s.Name)
+		return nil
+	})
+
 	(&m).initTailGroupProcessing()
 
 	return &m, nil
@@ -77,12 +125,53 @@ type GloriousConfig struct {
 	Units  []*unit.Unit `hcl:"unit"`
 	Groups map[string][]string
 
+	// Concurrency is the number of units that are started at once, it
+	// defaults to scheduler.DefaultConcurrency.
+	Concurrency int `hcl:"concurrency"`
+
+	// Project scopes the names of docker containers, so that they don't
+	// collide with those of other projects. It defaults to the name of
+	// the config file's directory.
+	Project string `hcl:"project"`
+
+	// Network is the docker network that docker units are connected to,
+	// it's named after the project unless it's given a name.
+	Network *provider.Network `hcl:"network"`
+	project *provider.Project
+
 	contxt gcontext.Context
 
 	tailGroupMux *sync.Mutex
 	tailGroups   map[string]*tailProcessState
 }
 
+// ResolvePaths resolves the relative paths in each unit's providers against
+// dir.
+func (g *GloriousConfig) ResolvePaths(dir string) error {
+	return g.eachSlot(func(u *unit.Unit, s *slot.Slot) error {
+		if err := s.Provider.ResolvePaths(dir); err != nil {
+			return fmt.Errorf("unit %q: %s", u.Name, err)
+		}
+		return nil
+	})
+}
+
+// eachSlot calls fn with each slot, that has a provider, of each unit, until
+// it returns an error.
+func (g *GloriousConfig) eachSlot(fn func(*unit.Unit, *slot.Slot) error) error {
+	for _, u := range g.Units {
+		for i := range u.Slots {
+			if u.Slots[i].Provider == nil {
+				continue
+			}
+			if err := fn(u, &u.Slots[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (g *GloriousConfig) initTailGroupProcessing() {
 	g.tailGroupMux = new(sync.Mutex)
 	g.tailGroups = make(map[string]*tailProcessState)
@@ -90,31 +179,30 @@ func (g *GloriousConfig) initTailGroupProcessing() {
 	go g.cleanupOldTailGroups()
 }
 
-func (g *GloriousConfig) ExchangeTailToken(token string) ([]string, bool) {
+func (g *GloriousConfig) ExchangeTailToken(token string) ([]string, provider.LogOptions, bool) {
 	g.tailGroupMux.Lock()
 
 	state, ok := g.tailGroups[token]
 	if !ok {
 		g.tailGroupMux.Unlock()
-		return nil, ok
+		return nil, provider.LogOptions{}, ok
 	}
 
-	names := state.names
 	delete(g.tailGroups, token)
 
 	g.tailGroupMux.Unlock()
 
-	return names, ok
+	return state.names, state.opts, ok
 }
 
 func (g *GloriousConfig) cleanupOldTailGroups() {
-	ticker := time.NewTimer(time.Minute * 5)
+	ticker := time.NewTicker(time.Minute * 5)
 	for {
 		<-ticker.C
 
 		g.tailGroupMux.Lock()
 		for token, state := range g.tailGroups {
-			if state.createdAt.Add(time.Hour).After(time.Now()) {
+			if state.createdAt.Add(time.Hour).Before(time.Now()) {
 				delete(g.tailGroups, token)
 			}
 		}
@@ -124,14 +212,16 @@ func (g *GloriousConfig) cleanupOldTailGroups() {
 
 type tailProcessState struct {
 	names     []string
+	opts      provider.LogOptions
 	createdAt time.Time
 }
 
-func (g *GloriousConfig) CreateTailProcessToken(names []string) string {
+func (g *GloriousConfig) CreateTailProcessToken(names []string, opts provider.LogOptions) string {
 	g.tailGroupMux.Lock()
 	token := uuid.NewV4().String()
 	g.tailGroups[token] = &tailProcessState{
 		names:     names,
+		opts:      opts,
 		createdAt: time.Now(),
 	}
 	g.tailGroupMux.Unlock()
@@ -146,6 +236,20 @@ func (g *GloriousConfig) Validate() []*gerrors.ErrWithPath {
 		}
 	}
 
+	if g.Concurrency < 0 {
+		configErrs = append(configErrs, &gerrors.ErrWithPath{
+			Path: []string{"concurrency"},
+			Err:  gerrors.ErrInvalidConcurrency,
+		})
+	}
+
+	if cycle := unit.FindCycle(g.Units); cycle != nil {
+		configErrs = append(configErrs, &gerrors.ErrWithPath{
+			Path: []string{"unit", cycle[0], "depends_on"},
+			Err:  gerrors.DependencyCycleErr{Cycle: cycle},
+		})
+	}
+
 	return configErrs
 }
 
@@ -198,20 +302,29 @@ func (g *GloriousConfig) GetGroup(name string) ([]*unit.Unit, bool) {
 	return units, true
 }
 
+// GetUnits returns the units for the given unit and group names, without
+// duplicates.
 func (g *GloriousConfig) GetUnits(args []string) ([]*unit.Unit, error) {
-	var unitsToStart []*unit.Unit
+	var (
+		unitsToStart []*unit.Unit
+		seen         = make(map[*unit.Unit]bool)
+	)
 	for _, name := range args {
-		group, ok := g.GetGroup(name)
-		if ok {
-			return group, nil
-		}
-
-		unit, ok := g.GetUnit(name)
+		units, ok := g.GetGroup(name)
 		if !ok {
-			return nil, fmt.Errorf("unknown unit %q, aborting", name)
+			u, exists := g.GetUnit(name)
+			if !exists {
+				return nil, fmt.Errorf("unknown unit %q, aborting", name)
+			}
+			units = []*unit.Unit{u}
 		}
 
-		unitsToStart = append(unitsToStart, unit)
+		for _, u := range units {
+			if !seen[u] {
+				seen[u] = true
+				unitsToStart = append(unitsToStart, u)
+			}
+		}
 	}
 
 	return unitsToStart, nil
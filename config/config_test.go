@@ -1,9 +1,16 @@
 package config
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/provider"
+	"github.com/ttacon/glorious/unit"
 )
 
 func TestGloriousConfigValidate(t *testing.T) {
@@ -19,6 +26,22 @@ func TestGloriousConfigValidate(t *testing.T) {
 			raw:          remoteBashErrConfig,
 			expectedErrs: []error{errors.ErrBashRemoteMissingRemote},
 		},
+		{
+			raw:          restartPolicies,
+			expectedErrs: nil,
+		},
+		{
+			raw:          invalidRestartPolicy,
+			expectedErrs: []error{errors.ErrRestartUnknownPolicy},
+		},
+		{
+			raw:          commandForms,
+			expectedErrs: nil,
+		},
+		{
+			raw:          invalidCommand,
+			expectedErrs: []error{errors.ErrBashInvalidCommand},
+		},
 	}
 
 	for i, test := range tests {
@@ -30,6 +53,12 @@ func TestGloriousConfigValidate(t *testing.T) {
 		errs := config.Validate()
 		if len(errs) != len(test.expectedErrs) {
 			t.Errorf("[test %d] expected validation errors did not match returned: %v vs %v\n", i, errs, test.expectedErrs)
+			continue
+		}
+		for j, err := range errs {
+			if err.Err != test.expectedErrs[j] {
+				t.Errorf("[test %d] expected validation error %q, got %q\n", i, test.expectedErrs[j], err.Err)
+			}
 		}
 	}
 }
@@ -51,6 +80,209 @@ func TestGloriousConfig_Dependencies(t *testing.T) {
 	}
 }
 
+func TestGloriousConfig_DependencyConditions(t *testing.T) {
+	config, err := ParseConfig(appWithDependencyConditions)
+	if err != nil {
+		t.Fatal("failed to parse config, err: ", err)
+	}
+
+	app, _ := config.GetUnit("app")
+	if len(app.DependsOn) != 2 {
+		t.Error("app should have two dependencies, found: ", app.DependsOn)
+	}
+
+	var conditions = make(map[string]string)
+	for _, dep := range app.Dependencies {
+		if dep.Unit == nil {
+			t.Errorf("dependency %q was not resolved\n", dep.Name)
+		}
+		conditions[dep.Name] = dep.Condition
+	}
+	if conditions["db"] != "healthy" || conditions["cache"] != "" {
+		t.Error("unexpected dependency conditions: ", conditions)
+	}
+
+	if errs := config.Validate(); len(errs) != 0 {
+		t.Error("unexpected validation errors: ", errs)
+	}
+
+	app.Dependencies[0].Condition = "eventually"
+	if errs := config.Validate(); len(errs) != 1 {
+		t.Error("expected unknown condition to fail validation, got: ", errs)
+	}
+}
+
+func TestGloriousConfig_DependencyCycle(t *testing.T) {
+	config, err := ParseConfig(cyclicDependencies)
+	if err != nil {
+		t.Fatal("failed to parse config, err: ", err)
+	}
+
+	errs := config.Validate()
+	if len(errs) != 1 {
+		t.Fatal("expected a single validation error, got: ", errs)
+	}
+
+	cycleErr, ok := errs[0].Err.(errors.DependencyCycleErr)
+	if !ok {
+		t.Fatal("expected a dependency cycle error, got: ", errs[0])
+	}
+
+	cycle := strings.Join(cycleErr.Cycle, " -> ")
+	if cycle != "a -> b -> c -> a" {
+		t.Error("unexpected cycle: ", cycle)
+	}
+}
+
+func TestGloriousConfig_StartStopOrder(t *testing.T) {
+	config, err := ParseConfig(appWithDependencies)
+	if err != nil {
+		t.Fatal("failed to parse config, err: ", err)
+	}
+
+	names := func(units []*unit.Unit) string {
+		var names []string
+		for _, u := range units {
+			names = append(names, u.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	app, _ := config.GetUnit("app")
+	if order := names(unit.StartOrder([]*unit.Unit{app})); order != "db,cache,app" {
+		t.Error("unexpected start order: ", order)
+	}
+
+	units, err := config.GetUnits([]string{"db", "app", "cache"})
+	if err != nil {
+		t.Fatal("failed to retrieve units, err: ", err)
+	}
+	if order := names(unit.StopOrder(units)); order != "app,cache,db" {
+		t.Error("unexpected stop order: ", order)
+	}
+}
+
+func TestGloriousConfig_ExchangeTailToken(t *testing.T) {
+	config, err := ParseConfig(appWithDependencies)
+	if err != nil {
+		t.Fatal("failed to parse config, err: ", err)
+	}
+
+	token := config.CreateTailProcessToken(
+		[]string{"app", "db"},
+		provider.LogOptions{Lines: 10, Follow: true},
+	)
+
+	names, opts, ok := config.ExchangeTailToken(token)
+	if !ok {
+		t.Fatal("expected token to be exchangeable")
+	} else if len(names) != 2 || names[0] != "app" || names[1] != "db" {
+		t.Error("unexpected names for token: ", names)
+	} else if opts.Lines != 10 || !opts.Follow {
+		t.Error("unexpected options for token: ", opts)
+	}
+
+	if _, _, ok := config.ExchangeTailToken(token); ok {
+		t.Error("token should only be exchangeable once")
+	}
+}
+
+func TestGloriousConfig_RestartPolicies(t *testing.T) {
+	config, err := ParseConfig(restartPolicies)
+	if err != nil {
+		t.Fatal("failed to parse config, err: ", err)
+	}
+
+	worker, _ := config.GetUnit("worker")
+	if worker.RestartPolicy == nil || worker.RestartPolicy.Policy != "on-failure" {
+		t.Fatal("expected worker to have an on-failure restart policy")
+	} else if worker.RestartPolicy.MaxRetries != 5 || worker.RestartPolicy.Backoff != "2s" {
+		t.Error("unexpected restart policy: ", worker.RestartPolicy)
+	}
+
+	policy := worker.Slots[0].RestartPolicy
+	if policy == nil || policy.Policy != "always" {
+		t.Error("expected slot to have its own restart policy")
+	}
+}
+
+func TestGloriousConfig_CommandForms(t *testing.T) {
+	config, err := ParseConfig(commandForms)
+	if err != nil {
+		t.Fatal("failed to parse config, err: ", err)
+	}
+
+	var expected = map[string]interface{}{
+		"exec":  []interface{}{"npm", "run", "start"},
+		"shell": "PORT=3000 npm start",
+	}
+	for name, cmd := range expected {
+		u, _ := config.GetUnit(name)
+		if got := u.Slots[0].Provider.Cmd; !reflect.DeepEqual(got, cmd) {
+			t.Errorf("expected %s to have cmd %#v, got %#v\n", name, cmd, got)
+		}
+	}
+}
+
+func TestLoadConfig_ResolvesPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.glorious")
+	if err := ioutil.WriteFile(configFile, []byte(relativePaths), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatal("failed to load config, err: ", err)
+	}
+
+	api, _ := config.GetUnit("api")
+	if got, expected := api.Slots[0].Provider.WorkingDir, filepath.Join(dir, "api"); got != expected {
+		t.Errorf("expected workingDir %q, got %q\n", expected, got)
+	}
+	if got, expected := api.Slots[0].Provider.EnvFile, []string{filepath.Join(dir, ".env")}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected env_file %q, got %q\n", expected, got)
+	}
+
+	if expected := provider.ProjectName(filepath.Base(dir)); config.project.Name != expected {
+		t.Errorf("expected project %q, got %q\n", expected, config.project.Name)
+	}
+
+	db, _ := config.GetUnit("db")
+	if got, expected := db.Slots[0].Provider.Volumes, []string{filepath.Join(dir, "data") + ":/data"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected volumes %q, got %q\n", expected, got)
+	}
+}
+
+func TestGloriousConfig_Project(t *testing.T) {
+	var tests = []struct {
+		raw             string
+		expectedProject string
+		expected        provider.Network
+	}{
+		{basicConfig, provider.DefaultProjectName, provider.Network{}},
+		{projectNetwork, "my-shop", provider.Network{Name: "shop", Driver: "bridge"}},
+	}
+
+	for i, test := range tests {
+		config, err := ParseConfig(test.raw)
+		if err != nil {
+			t.Fatalf("[test %d] failed to parse config, err: %s\n", i, err)
+		}
+		if config.project.Name != test.expectedProject {
+			t.Errorf("[test %d] expected project %q, got %q\n", i, test.expectedProject, config.project.Name)
+		}
+		if !reflect.DeepEqual(*config.Network, test.expected) {
+			t.Errorf("[test %d] expected network %+v, got %+v\n", i, test.expected, *config.Network)
+		}
+	}
+}
+
 const (
 	basicConfig = `
 unit "yolo" {
@@ -118,5 +350,217 @@ unit "app" {
     }
   }
 }
+`
+
+	appWithDependencyConditions = `
+unit "db" {
+  name = "db"
+  description = "Mongo DB"
+
+  slot "dev" {
+    provider {
+      type = "docker/local"
+      image = "mongo:4.2.3-bionic"
+    }
+
+    healthcheck {
+      type = "tcp"
+      address = "localhost:27017"
+    }
+  }
+}
+
+unit "cache" {
+  name = "cache"
+  description = "Cache for app"
+
+  slot "dev" {
+    provider {
+      type = "docker/local"
+      image = "redis:5"
+    }
+  }
+}
+
+unit "app" {
+  name = "app"
+  description = "application"
+
+  depends_on = [ "cache" ]
+
+  dependency "db" {
+    condition = "healthy"
+    timeout = "30s"
+  }
+
+  slot "dev" {
+    provider {
+      type = "bash/local"
+      cmd = "npm start"
+    }
+  }
+}
+`
+
+	cyclicDependencies = `
+unit "a" {
+  name = "a"
+  depends_on = [ "b" ]
+
+  slot "dev" {
+    provider {
+      type = "bash/local"
+      cmd = "./a"
+    }
+  }
+}
+
+unit "b" {
+  name = "b"
+  depends_on = [ "c" ]
+
+  slot "dev" {
+    provider {
+      type = "bash/local"
+      cmd = "./b"
+    }
+  }
+}
+
+unit "c" {
+  name = "c"
+  depends_on = [ "a" ]
+
+  slot "dev" {
+    provider {
+      type = "bash/local"
+      cmd = "./c"
+    }
+  }
+}
+`
+
+	restartPolicies = `
+unit "worker" {
+  name = "worker"
+
+  restart {
+    policy = "on-failure"
+    max_retries = 5
+    backoff = "2s"
+  }
+
+  slot "dev" {
+    provider {
+      type = "bash/local"
+      cmd = "./worker"
+    }
+
+    restart {
+      policy = "always"
+    }
+  }
+}
+`
+
+	invalidRestartPolicy = `
+unit "worker" {
+  name = "worker"
+
+  restart {
+    policy = "sometimes"
+  }
+
+  slot "dev" {
+    provider {
+      type = "bash/local"
+      cmd = "./worker"
+    }
+  }
+}
+`
+
+	commandForms = `
+unit "exec" {
+  name = "exec"
+
+  slot "dev" {
+    provider {
+      type = "bash/local"
+      cmd = ["npm", "run", "start"]
+    }
+  }
+}
+
+unit "shell" {
+  name = "shell"
+
+  slot "dev" {
+    provider {
+      type = "bash/local"
+      cmd = "PORT=3000 npm start"
+    }
+  }
+}
+`
+
+	projectNetwork = `
+project = "My Shop"
+
+network {
+  name = "shop"
+  driver = "bridge"
+}
+
+unit "db" {
+  name = "db"
+
+  slot "dev" {
+    provider {
+      type = "docker/local"
+      image = "mongo"
+    }
+  }
+}
+`
+
+	relativePaths = `
+unit "api" {
+  name = "api"
+
+  slot "dev" {
+    provider {
+      type = "bash/local"
+      workingDir = "./api"
+      env_file = [".env"]
+      cmd = "npm start"
+    }
+  }
+}
+
+unit "db" {
+  name = "db"
+
+  slot "dev" {
+    provider {
+      type = "docker/local"
+      image = "postgres"
+      volumes = ["./data:/data"]
+    }
+  }
+}
+`
+
+	invalidCommand = `
+unit "worker" {
+  name = "worker"
+
+  slot "dev" {
+    provider {
+      type = "bash/local"
+      cmd = ["./worker", 3]
+    }
+  }
+}
 `
 )
@@ -21,13 +21,29 @@ var (
 		"bash/remote",
 		errors.New("must provide, at least, both host and user"),
 	}
+	ErrBashRemoteMissingIdentityFile = ProviderErr{
+		"bash/remote",
+		errors.New("identityFile does not exist"),
+	}
+	ErrBashRemoteInvalidPort = ProviderErr{
+		"bash/remote",
+		errors.New("port must be between 1 and 65535"),
+	}
+	ErrBashRemoteInvalidSSHOption = ProviderErr{
+		"bash/remote",
+		errors.New("sshOptions must give ConnectTimeout and ServerAliveInterval in seconds, and IdentityFile a path"),
+	}
 	ErrBashMissingCommand = ProviderErr{
 		"bash/*",
 		errors.New("must provide command"),
 	}
+	ErrBashInvalidCommand = ProviderErr{
+		"bash/*",
+		errors.New("cmd must be a string or a list of strings"),
+	}
 	ErrBashExtraneousFields = ProviderErr{
 		"bash/*",
-		errors.New("provider does not support fields beyond cmd, workingDir, remote and resolver"),
+		errors.New("provider does not support image, ports, volumes or other docker container fields"),
 	}
 	ErrDockerRemoteMissingRemote = ProviderErr{
 		"docker/remote",
@@ -39,12 +55,71 @@ var (
 	}
 	ErrDockerExtraneousFields = ProviderErr{
 		"docker/*",
-		errors.New("provider does not support cmd or workingDir"),
+		errors.New("provider does not support handlers"),
+	}
+
+	ErrInvalidEnvironment = ProviderErr{
+		"*",
+		errors.New("environment must be a list of KEY=VALUE or KEY"),
+	}
+
+	ErrPluginNotFound = ProviderErr{
+		"plugin/*",
+		errors.New("could not find glorious-provider-<name> in ~/.glorious/plugins or on the PATH"),
 	}
 
 	ErrStopStopped = errors.New("cannot stop stopped unit")
+
+	ErrHealthCheckUnknownType    = errors.New("healthcheck type must be one of http, tcp or exec")
+	ErrHealthCheckMissingURL     = errors.New("http healthcheck must provide url")
+	ErrHealthCheckMissingAddress = errors.New("tcp healthcheck must provide address")
+	ErrHealthCheckMissingCmd     = errors.New("exec healthcheck must provide cmd")
 )
 
+var ErrInvalidConcurrency = errors.New("concurrency must be a positive number")
+
+var ErrUnknownDependencyCondition = errors.New(
+	"dependency condition must be one of started, running or healthy",
+)
+
+var (
+	ErrRestartUnknownPolicy      = errors.New("restart policy must be one of no, on-failure or always")
+	ErrRestartNegativeMaxRetries = errors.New("max_retries cannot be negative")
+	ErrRestartInvalidBackoff     = errors.New("backoff must be a duration, i.e. 500ms or 2s")
+	ErrRestartInvalidMaxBackoff  = errors.New("max_backoff must be a duration, i.e. 30s or 1m")
+)
+
+// DependencyErr is returned when a unit can't be started because one of its
+// dependencies never became ready.
+type DependencyErr struct {
+	Unit       string
+	Dependency string
+	Condition  string
+	Err        error
+}
+
+func (d DependencyErr) Error() string {
+	return fmt.Sprintf(
+		"cannot start %q, dependency %q is not %s: %s",
+		d.Unit,
+		d.Dependency,
+		d.Condition,
+		d.Err,
+	)
+}
+
+// DependencyCycleErr is returned when units depend on each other.
+type DependencyCycleErr struct {
+	Cycle []string
+}
+
+func (d DependencyCycleErr) Error() string {
+	return fmt.Sprintf(
+		"dependency cycle detected: %s",
+		strings.Join(d.Cycle, " -> "),
+	)
+}
+
 type ErrWithPath struct {
 	Path []string
 	Err  error
@@ -0,0 +1,187 @@
+// Package health implements the optional health checks that can be defined
+// on a slot.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+
+	gerrors "github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/status"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultTimeout  = 5 * time.Second
+	defaultRetries  = 3
+)
+
+// Check is the `healthcheck` block of a slot.
+type Check struct {
+	// Type is one of http, tcp or exec.
+	Type string `hcl:"type"`
+
+	// URL is requested by http checks, any 2xx or 3xx response is
+	// healthy.
+	URL string `hcl:"url"`
+
+	// Address is connected to by tcp checks (i.e. localhost:6379).
+	Address string `hcl:"address"`
+
+	// Cmd is run by exec checks through /bin/sh, exiting zero is
+	// healthy.
+	Cmd string `hcl:"cmd"`
+
+	Interval    string `hcl:"interval"`
+	Timeout     string `hcl:"timeout"`
+	Retries     int    `hcl:"retries"`
+	StartPeriod string `hcl:"start_period"`
+}
+
+func (c *Check) Validate() []error {
+	var errs []error
+	switch c.Type {
+	case "http":
+		if len(c.URL) == 0 {
+			errs = append(errs, gerrors.ErrHealthCheckMissingURL)
+		}
+	case "tcp":
+		if len(c.Address) == 0 {
+			errs = append(errs, gerrors.ErrHealthCheckMissingAddress)
+		}
+	case "exec":
+		if len(c.Cmd) == 0 {
+			errs = append(errs, gerrors.ErrHealthCheckMissingCmd)
+		}
+	default:
+		errs = append(errs, gerrors.ErrHealthCheckUnknownType)
+	}
+
+	for name, raw := range map[string]string{
+		"interval":     c.Interval,
+		"timeout":      c.Timeout,
+		"start_period": c.StartPeriod,
+	} {
+		if _, err := parseDuration(raw, 0); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %s", name, err))
+		}
+	}
+
+	if c.Retries < 0 {
+		errs = append(errs, errors.New("retries cannot be negative"))
+	}
+
+	return errs
+}
+
+func parseDuration(raw string, def time.Duration) (time.Duration, error) {
+	if len(raw) == 0 {
+		return def, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+func (c *Check) interval() time.Duration {
+	d, err := parseDuration(c.Interval, defaultInterval)
+	if err != nil || d <= 0 {
+		return defaultInterval
+	}
+	return d
+}
+
+func (c *Check) timeout() time.Duration {
+	d, err := parseDuration(c.Timeout, defaultTimeout)
+	if err != nil || d <= 0 {
+		return defaultTimeout
+	}
+	return d
+}
+
+func (c *Check) retries() int {
+	if c.Retries <= 0 {
+		return defaultRetries
+	}
+	return c.Retries
+}
+
+func (c *Check) startPeriod() time.Duration {
+	d, _ := parseDuration(c.StartPeriod, 0)
+	return d
+}
+
+// Probe runs the check once.
+func (c *Check) Probe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout())
+	defer cancel()
+
+	switch c.Type {
+	case "http":
+		req, err := http.NewRequest(http.MethodGet, c.URL, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return nil
+	case "tcp":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", c.Address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "exec":
+		return exec.CommandContext(ctx, "/bin/sh", "-c", c.Cmd).Run()
+	default:
+		return gerrors.ErrHealthCheckUnknownType
+	}
+}
+
+// Monitor runs the check against the status until the unit stops, updating
+// its health as it goes. It is meant to be run in its own goroutine.
+//
+// Failures during the start period don't count towards the retries, the
+// unit is only unhealthy once the check has failed retries times in a row.
+func (c *Check) Monitor(stat *status.Status) {
+	var (
+		startedAt = time.Now()
+		failures  = 0
+		ticker    = time.NewTicker(c.interval())
+	)
+	defer ticker.Stop()
+
+	stat.SetHealth(status.Starting, nil)
+	for {
+		stat.Lock()
+		running := stat.IsRunning()
+		stat.Unlock()
+		if !running || stat.ShutdownRequested() {
+			return
+		}
+
+		if err := c.Probe(); err == nil {
+			failures = 0
+			stat.SetHealth(status.Healthy, nil)
+		} else if time.Since(startedAt) >= c.startPeriod() {
+			failures++
+			if failures >= c.retries() {
+				stat.SetHealth(status.Unhealthy, err)
+			}
+		}
+
+		<-ticker.C
+	}
+}
@@ -0,0 +1,116 @@
+package health
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ttacon/glorious/status"
+)
+
+func TestCheckValidate(t *testing.T) {
+	var tests = []struct {
+		check       Check
+		expectedErr bool
+	}{
+		{Check{Type: "http", URL: "http://localhost:8080/health"}, false},
+		{Check{Type: "http"}, true},
+		{Check{Type: "tcp", Address: "localhost:6379", Interval: "1s"}, false},
+		{Check{Type: "tcp", Address: "localhost:6379", Interval: "soon"}, true},
+		{Check{Type: "exec", Cmd: "true", Retries: -1}, true},
+		{Check{Type: "grpc"}, true},
+	}
+
+	for i, test := range tests {
+		errs := test.check.Validate()
+		if (len(errs) > 0) != test.expectedErr {
+			t.Errorf("[test %d] unexpected validation errors: %v\n", i, errs)
+		}
+	}
+}
+
+func TestCheckProbe(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var tests = []struct {
+		check       Check
+		expectedErr bool
+	}{
+		{Check{Type: "http", URL: healthy.URL}, false},
+		{Check{Type: "http", URL: unhealthy.URL}, true},
+		{Check{Type: "tcp", Address: listener.Addr().String()}, false},
+	}
+
+	for i, test := range tests {
+		if err := test.check.Probe(); (err != nil) != test.expectedErr {
+			t.Errorf("[test %d] unexpected probe result: %v\n", i, err)
+		}
+	}
+}
+
+func TestCheckMonitor(t *testing.T) {
+	var unhealthy int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&unhealthy) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	check := &Check{
+		Type:     "http",
+		URL:      server.URL,
+		Interval: "10ms",
+		Retries:  2,
+	}
+
+	stat := status.NewRunningStatus(nil, nil)
+	go check.Monitor(stat)
+	defer func() {
+		// Units are stopped with their status locked.
+		stat.Lock()
+		stat.Stop()
+		stat.Unlock()
+	}()
+
+	waitFor := func(expected status.UnitStatus) {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			stat.Lock()
+			current := stat.CurrentStatus
+			stat.Unlock()
+			if current == expected {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("status never became %s, is %s", &status.Status{CurrentStatus: expected}, stat)
+	}
+
+	waitFor(status.Healthy)
+
+	atomic.StoreInt32(&unhealthy, 1)
+	waitFor(status.Unhealthy)
+	stat.Lock()
+	defer stat.Unlock()
+	if len(stat.HealthErr) == 0 {
+		t.Error("expected health error to be recorded")
+	}
+}
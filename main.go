@@ -1,18 +1,29 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
+	"net/rpc"
 	"net/rpc/jsonrpc"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/abiosoft/ishell"
+	"github.com/fatih/color"
 	"github.com/sirupsen/logrus"
 	"github.com/ttacon/glorious/agent"
 	"github.com/ttacon/glorious/config"
 	"github.com/ttacon/glorious/context"
+	"github.com/ttacon/glorious/provider"
+	"github.com/ttacon/glorious/scheduler"
+	"github.com/ttacon/glorious/tailer"
 )
 
 var (
@@ -47,10 +58,11 @@ func main() {
 		os.Exit(1)
 	}
 	if errs := conf.Validate(); len(errs) > 0 {
-		lgr.Debug("validation errors detected:")
+		lgr.Error("validation errors detected:")
 		for i, err := range errs {
-			lgr.Debug("[err %d] %s\n", i, err)
+			lgr.Errorf("[err %d] %s\n", i, err)
 		}
+		provider.Shutdown()
 		os.Exit(1)
 	}
 
@@ -67,32 +79,37 @@ func main() {
 	if *daemonMode {
 		if err := conf.Init(); err != nil {
 			lgr.Error("failed to initialize config, err: ", err)
+			provider.Shutdown()
 			os.Exit(1)
 		}
 
-		if err := runServer(agnt, *addr, lgr); err != nil {
+		// Plugins are killed however the daemon ends up exiting.
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			lgr.Infof("received %s, shutting down\n", sig)
+			provider.Shutdown()
+			os.Exit(0)
+		}()
+
+		err := runServer(agnt, *addr, lgr)
+		provider.Shutdown()
+		if err != nil {
 			lgr.Error(err)
 			os.Exit(1)
 		}
 		return
 	}
 
-	conn, err := net.Dial("tcp", *addr)
-	if err != nil {
-		lgr.Error(err)
-		os.Exit(1)
-	}
+	// Plugins are only run by the daemon, those started to validate the
+	// config aren't needed anymore.
+	provider.Shutdown()
 
-	if n, err := conn.Write(MAGIC_COOKIE_V1); err != nil {
+	conn, err := dialDaemon(*addr, MAGIC_COOKIE_V1)
+	if err != nil {
 		lgr.Error(err)
 		os.Exit(1)
-	} else if n != len(MAGIC_COOKIE_V1) {
-		lgr.Errorf(
-			"failed to write all of the magic cookie, wrote %d of %d bytes\n",
-			n,
-			len(MAGIC_COOKIE_V1),
-		)
-		os.Exit(1)
 	}
 
 	client := jsonrpc.NewClient(conn)
@@ -150,12 +167,22 @@ func main() {
 				return
 			}
 
-			c.Printf("%-20s|%-20s| %-9s\n", "Name", "Groups", "Status")
+			c.Printf(
+				"%-20s|%-20s| %-10s| %-9s| %-10s| Details\n",
+				"Name",
+				"Groups",
+				"Status",
+				"Restarts",
+				"Exit Code",
+			)
 			for _, unit := range units {
-				c.Printf("%-20s|%-20s| %-9s\n",
+				c.Printf("%-20s|%-20s| %-10s| %-9d| %-10s| %s\n",
 					unit.Name,
 					strings.Join(unit.Groups, ", "),
 					unit.Status,
+					unit.Restarts,
+					unit.ExitCode,
+					unit.Details,
 				)
 			}
 		},
@@ -167,12 +194,12 @@ func main() {
 		Func: func(c *ishell.Context) {
 			lgr.Debug("command invoked: ", c.Cmd.Name)
 
-			var respErr error
-			if err := client.Call("Agent.Reload", struct{}{}, &respErr); err != nil {
+			var resp agent.ErrResponse
+			if err := client.Call("Agent.Reload", struct{}{}, &resp); err != nil {
 				lgr.Error(err)
 				return
-			} else if respErr != nil {
-				lgr.Error(err)
+			} else if len(resp.Err) > 0 {
+				c.Println(resp.Err)
 				return
 			}
 			c.Printf("Reloaded glorious config from %s\n", *configFileLocation)
@@ -181,25 +208,18 @@ func main() {
 
 	shell.AddCmd(&ishell.Cmd{
 		Name: "start",
-		Help: "Start a given unit",
+		Help: "Start the given units or groups, and their dependencies: start <unit...> [-j N] [--force-recreate]",
 		Func: func(c *ishell.Context) {
 			lgr.Debug("command invoked: ", c.Cmd.Name)
 
-			for _, arg := range c.Args {
-				c.Printf("starting %q...\n", arg)
-
-				var respErr string
-				if err := client.Call(
-					"Agent.StartUnit",
-					arg,
-					&respErr,
-				); err != nil {
-					c.Println(err)
-				} else if len(respErr) > 0 {
-					c.Println(respErr)
-				} else {
-					c.Println("done")
-				}
+			req, err := parseStartArgs(c.Args)
+			if err != nil {
+				c.Println(err)
+				return
+			}
+
+			if err := startUnits(c, client, req); err != nil {
+				c.Println(err)
 			}
 		},
 	})
@@ -277,46 +297,40 @@ func main() {
 
 	shell.AddCmd(&ishell.Cmd{
 		Name: "stop",
-		Help: "Stops given units",
+		Help: "Stops the given units or groups, dependents first",
 		Func: func(c *ishell.Context) {
 			lgr.Debug("command invoked: ", c.Cmd.Name)
 
-			for _, arg := range c.Args {
-				c.Printf("stopping %q...", arg)
-
-				var respErr string
-				if err := client.Call(
-					"Agent.StopUnit",
-					arg,
-					&respErr,
-				); err != nil {
-					c.Println(err)
-				} else if len(respErr) > 0 {
-					c.Println(respErr)
-				} else {
-					c.Println("done")
-				}
-			}
+			runUnitsCmd(c, client, "Agent.StopUnits", "stopping")
 		},
 	})
 
 	shell.AddCmd(&ishell.Cmd{
 		Name: "tail",
-		Help: "Tails a unit",
+		Help: "Tails units or groups: tail <unit...> [-n N] [--follow] [--since T]",
 		Func: func(c *ishell.Context) {
 			lgr.Debug("command invoked: ", c.Cmd.Name)
 
-			// be cheaper if we can
-			unitName := c.Args[0]
-			unit, ok := conf.GetUnit(unitName)
-			if !ok {
-				c.Printf("unknown unit %q, aborting\n", unitName)
+			req, err := parseTailArgs(c.Args)
+			if err != nil {
+				c.Println(err)
+				return
+			}
+
+			var resp agent.TailProcessesResponse
+			if err := client.Call(
+				"Agent.TailProcesses",
+				req,
+				&resp,
+			); err != nil {
+				c.Println(err)
+				return
+			} else if len(resp.Err) > 0 {
+				c.Println(resp.Err)
 				return
 			}
 
-			// if there are no more args, run a following tail, if
-			// there's a number, run a number sliced tail
-			if err := unit.Tail(); err != nil {
+			if err := tailUnits(c, *addr, req.Follow, resp.Token, resp.Names); err != nil {
 				c.Println(err)
 			}
 		},
@@ -326,6 +340,270 @@ func main() {
 	shell.Run()
 }
 
+func dialDaemon(addr string, cookie []byte) (net.Conn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := conn.Write(cookie); err != nil {
+		_ = conn.Close()
+		return nil, err
+	} else if n != len(cookie) {
+		_ = conn.Close()
+		return nil, fmt.Errorf(
+			"failed to write all of the magic cookie, wrote %d of %d bytes",
+			n,
+			len(cookie),
+		)
+	}
+
+	return conn, nil
+}
+
+func runUnitsCmd(c *ishell.Context, client *rpc.Client, method, action string) {
+	if len(c.Args) == 0 {
+		c.Println("must provide at least one unit or group")
+		return
+	}
+
+	c.Printf("%s %s...\n", action, strings.Join(c.Args, ", "))
+
+	var resp agent.UnitsResponse
+	if err := client.Call(
+		method,
+		agent.UnitsRequest{Names: c.Args},
+		&resp,
+	); err != nil {
+		c.Println(err)
+		return
+	} else if len(resp.Err) > 0 {
+		c.Println(resp.Err)
+		return
+	}
+
+	for _, result := range resp.Results {
+		if len(result.Err) > 0 {
+			c.Printf("%s %q... %s\n", action, result.Name, result.Err)
+		} else {
+			c.Printf("%s %q... done\n", action, result.Name)
+		}
+	}
+}
+
+func parseStartArgs(args []string) (*agent.StartUnitsRequest, error) {
+	req := &agent.StartUnitsRequest{}
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-j":
+			if i+1 >= len(args) {
+				return nil, errors.New("-j requires a number of units")
+			}
+			i++
+
+			concurrency, err := strconv.Atoi(args[i])
+			if err != nil || concurrency <= 0 {
+				return nil, fmt.Errorf("invalid concurrency %q", args[i])
+			}
+			req.Concurrency = concurrency
+		case "--force-recreate":
+			req.ForceRecreate = true
+		default:
+			req.Names = append(req.Names, arg)
+		}
+	}
+
+	if len(req.Names) == 0 {
+		return nil, errors.New("must provide at least one unit or group")
+	}
+
+	return req, nil
+}
+
+// progressPollInterval is how often the progress of a start is polled for.
+var progressPollInterval = 250 * time.Millisecond
+
+func startUnits(c *ishell.Context, client *rpc.Client, req *agent.StartUnitsRequest) error {
+	c.Printf("starting %s...\n", strings.Join(req.Names, ", "))
+
+	var resp agent.StartUnitsResponse
+	if err := client.Call("Agent.StartUnits", req, &resp); err != nil {
+		return err
+	} else if len(resp.Err) > 0 {
+		return errors.New(resp.Err)
+	}
+
+	var offset int
+	for {
+		var progress agent.ProgressResponse
+		if err := client.Call(
+			"Agent.Progress",
+			agent.ProgressRequest{ID: resp.OperationID, Offset: offset},
+			&progress,
+		); err != nil {
+			return err
+		} else if len(progress.Err) > 0 {
+			return errors.New(progress.Err)
+		}
+
+		offset += len(progress.Events)
+		for _, e := range progress.Events {
+			printProgress(c, e)
+		}
+
+		if progress.Done {
+			if len(progress.OperationErr) > 0 {
+				return errors.New(progress.OperationErr)
+			}
+			return nil
+		}
+
+		time.Sleep(progressPollInterval)
+	}
+}
+
+func printProgress(c *ishell.Context, e scheduler.Event) {
+	var state string
+	switch e.State {
+	case scheduler.StateQueued:
+		// Everything is queued up front, which isn't very interesting.
+		return
+	case scheduler.StateStarted, scheduler.StateRunning:
+		state = color.GreenString(e.State)
+	case scheduler.StateFailed, scheduler.StateSkipped:
+		state = color.RedString(e.State)
+	default:
+		state = color.YellowString(e.State)
+	}
+
+	if len(e.Message) > 0 {
+		c.Printf("[%s] %s: %s\n", e.Unit, state, e.Message)
+	} else {
+		c.Printf("[%s] %s\n", e.Unit, state)
+	}
+}
+
+func parseTailArgs(args []string) (*agent.TailProcessesRequest, error) {
+	// Like tail(1), only show the last few lines unless told otherwise.
+	req := &agent.TailProcessesRequest{
+		Lines: 10,
+	}
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-f", "--follow":
+			req.Follow = true
+		case "-n":
+			if i+1 >= len(args) {
+				return nil, errors.New("-n requires a number of lines")
+			}
+			i++
+
+			lines, err := strconv.Atoi(args[i])
+			if err != nil || lines < 0 {
+				return nil, fmt.Errorf("invalid number of lines %q", args[i])
+			}
+			req.Lines = lines
+		case "--since":
+			if i+1 >= len(args) {
+				return nil, errors.New("--since requires a timestamp or duration")
+			}
+			i++
+
+			req.Since = args[i]
+		default:
+			req.Names = append(req.Names, arg)
+		}
+	}
+
+	if len(req.Names) == 0 {
+		return nil, errors.New("must provide at least one unit or group to tail")
+	}
+
+	return req, nil
+}
+
+var tailColors = []color.Attribute{
+	color.FgCyan,
+	color.FgGreen,
+	color.FgYellow,
+	color.FgMagenta,
+	color.FgBlue,
+	color.FgRed,
+}
+
+func tailUnits(c *ishell.Context, addr string, follow bool, token string, names []string) error {
+	conn, err := dialDaemon(addr, MAGIC_COOKIE_V1_LOGS)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(token)); err != nil {
+		return err
+	}
+
+	var width int
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	prefixes := make(map[string]string, len(names))
+	for i, name := range names {
+		prefixes[name] = color.New(tailColors[i%len(tailColors)]).Sprintf(
+			"%-*s |",
+			width,
+			name,
+		)
+	}
+
+	// Closing the connection on Ctrl-C ends the decode loop below and
+	// lets the daemon know we've gone away.
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	defer signal.Stop(interrupted)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-interrupted:
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	dec := json.NewDecoder(conn)
+	remaining := len(names)
+	for remaining > 0 {
+		var line tailer.Line
+		if err := dec.Decode(&line); err != nil {
+			// Either we were interrupted or the daemon hung up, both
+			// of which end the tail.
+			return nil
+		}
+
+		prefix := prefixes[line.Unit]
+		switch {
+		case len(line.Err) > 0:
+			c.Printf("%s failed to tail: %s\n", prefix, line.Err)
+		case line.EOF:
+			// Nothing comes after a unit's EOF, so we're done once
+			// every unit has sent one.
+			remaining--
+			if follow {
+				c.Printf("%s (stream ended)\n", prefix)
+			}
+		default:
+			c.Printf("%s %s\n", prefix, line.Text)
+		}
+	}
+	return nil
+}
+
 const banner = `
        _            _
   __ _| | ___  _ __(_) ___  _   _ ___
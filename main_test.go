@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/ishell"
+	"github.com/fatih/color"
+	"github.com/ttacon/glorious/agent"
+	"github.com/ttacon/glorious/tailer"
+)
+
+func TestParseTailArgs(t *testing.T) {
+	var tests = []struct {
+		args        []string
+		expected    *agent.TailProcessesRequest
+		expectedErr string
+	}{
+		{
+			args:     []string{"api"},
+			expected: &agent.TailProcessesRequest{Names: []string{"api"}, Lines: 10},
+		},
+		{
+			args: []string{"api", "-n", "50", "--follow", "db"},
+			expected: &agent.TailProcessesRequest{
+				Names:  []string{"api", "db"},
+				Lines:  50,
+				Follow: true,
+			},
+		},
+		{
+			args: []string{"-f", "-n", "0", "--since", "10m", "backend"},
+			expected: &agent.TailProcessesRequest{
+				Names:  []string{"backend"},
+				Follow: true,
+				Since:  "10m",
+			},
+		},
+		// Names aren't checked until they get to the daemon, unknown
+		// units included.
+		{
+			args:     []string{"nonexistent"},
+			expected: &agent.TailProcessesRequest{Names: []string{"nonexistent"}, Lines: 10},
+		},
+		{args: []string{"api", "-n"}, expectedErr: "-n requires a number of lines"},
+		{args: []string{"api", "-n", "ten"}, expectedErr: `invalid number of lines "ten"`},
+		{args: []string{"api", "-n", "-1"}, expectedErr: `invalid number of lines "-1"`},
+		{args: []string{"api", "--since"}, expectedErr: "--since requires a timestamp or duration"},
+		{args: []string{"--follow"}, expectedErr: "must provide at least one unit or group to tail"},
+		{args: nil, expectedErr: "must provide at least one unit or group to tail"},
+	}
+
+	for i, test := range tests {
+		req, err := parseTailArgs(test.args)
+		if len(test.expectedErr) > 0 {
+			if err == nil || err.Error() != test.expectedErr {
+				t.Errorf("[test %d] expected error %q, got: %v\n", i, test.expectedErr, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("[test %d] unexpected error: %s\n", i, err)
+		} else if !reflect.DeepEqual(req, test.expected) {
+			t.Errorf("[test %d] expected %+v, got %+v\n", i, test.expected, req)
+		}
+	}
+}
+
+// fakeActions collects what's printed to the shell.
+type fakeActions struct {
+	ishell.Actions
+
+	printed chan string
+}
+
+func (f *fakeActions) Printf(format string, val ...interface{}) {
+	f.printed <- fmt.Sprintf(format, val...)
+}
+
+// fakeTailServer accepts a single tail connection, checking that it's
+// asked for token, and sends it the given lines. It's closed once the
+// client hangs up.
+func fakeTailServer(t *testing.T, token string, lines []tailer.Line) (string, chan struct{}) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hungUp := make(chan struct{})
+	go func() {
+		defer close(hungUp)
+		defer listener.Close()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		cookie := make([]byte, len(MAGIC_COOKIE_V1_LOGS))
+		if _, err := io.ReadFull(conn, cookie); err != nil || !bytes.Equal(cookie, MAGIC_COOKIE_V1_LOGS) {
+			t.Error("expected the logs cookie, got: ", cookie, err)
+			return
+		}
+		received := make([]byte, len(token))
+		if _, err := io.ReadFull(conn, received); err != nil || string(received) != token {
+			t.Errorf("expected token %q, got %q (%v)\n", token, received, err)
+			return
+		}
+
+		enc := json.NewEncoder(conn)
+		for _, line := range lines {
+			if err := enc.Encode(line); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+
+		// Stay connected until the client goes away.
+		_, _ = io.Copy(ioutil.Discard, conn)
+	}()
+
+	return listener.Addr().String(), hungUp
+}
+
+func TestTailUnits(t *testing.T) {
+	oldNoColor := color.NoColor
+	color.NoColor = true
+	defer func() {
+		color.NoColor = oldNoColor
+	}()
+
+	addr, hungUp := fakeTailServer(t, "token", []tailer.Line{
+		{Unit: "api", Text: "listening on :8080"},
+		{Unit: "nope", Err: "unknown unit"},
+		{Unit: "nope", EOF: true},
+		{Unit: "api", Text: "GET /"},
+		{Unit: "api", EOF: true},
+	})
+
+	actions := &fakeActions{printed: make(chan string, 10)}
+	c := &ishell.Context{Actions: actions}
+	if err := tailUnits(c, addr, true, "token", []string{"api", "nope"}); err != nil {
+		t.Fatal("failed to tail: ", err)
+	}
+	close(actions.printed)
+
+	var printed []string
+	for line := range actions.printed {
+		printed = append(printed, line)
+	}
+	expected := []string{
+		"api  | listening on :8080\n",
+		"nope | failed to tail: unknown unit\n",
+		"nope | (stream ended)\n",
+		"api  | GET /\n",
+		"api  | (stream ended)\n",
+	}
+	if !reflect.DeepEqual(printed, expected) {
+		t.Errorf("expected %q, got %q\n", expected, printed)
+	}
+
+	// The tail ends once every unit has sent its EOF, without waiting
+	// for the daemon to hang up.
+	select {
+	case <-hungUp:
+	case <-time.After(2 * time.Second):
+		t.Error("expected the client to hang up")
+	}
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/ishell"
+	"github.com/ttacon/glorious/tailer"
+)
+
+func TestTailUnitsInterrupted(t *testing.T) {
+	addr, hungUp := fakeTailServer(t, "token", []tailer.Line{
+		{Unit: "api", Text: "listening on :8080"},
+	})
+
+	actions := &fakeActions{printed: make(chan string, 10)}
+	c := &ishell.Context{Actions: actions}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- tailUnits(c, addr, true, "token", []string{"api"})
+	}()
+
+	// Once the first line is in, Ctrl-C is being listened for.
+	select {
+	case <-actions.printed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the unit's output")
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error("expected the tail to end quietly, got: ", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Ctrl-C to end the tail")
+	}
+	select {
+	case <-hungUp:
+	case <-time.After(2 * time.Second):
+		t.Error("expected the client to hang up")
+	}
+}
@@ -0,0 +1,289 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rjeczalik/notify"
+	gerrors "github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/status"
+)
+
+func init() {
+	Register("bash/local", newBashDriver(false))
+	Register("bash/remote", newBashDriver(true))
+}
+
+type bashDriver struct {
+	remote bool
+	runner runner
+
+	// Remote units watch their working directory for changes so that
+	// handlers can be run, these are the watchers keyed by unit name.
+	eventsMux *sync.Mutex
+	events    map[string]*watcher
+}
+
+// watcher is a remote unit's watch on its working directory, done is closed
+// once the watch is stopped so that the handlers stop being run.
+type watcher struct {
+	events chan notify.EventInfo
+	done   chan struct{}
+}
+
+// runner runs the processes for bash units, either locally or on a remote
+// host.
+type runner interface {
+	Start(p *Provider, u Unit) error
+	Stop(p *Provider, u Unit) error
+
+	// Attach finds a process that was started before we were, returning
+	// nil if there isn't one running.
+	Attach(p *Provider, u Unit) (*status.Status, error)
+	Logs(p *Provider, u Unit, opts LogOptions, dataChan chan []byte) (func(), error)
+}
+
+func newBashDriver(remote bool) *bashDriver {
+	var r runner = localRunner{}
+	if remote {
+		r = remoteRunner{}
+	}
+
+	return &bashDriver{
+		remote:    remote,
+		runner:    r,
+		eventsMux: new(sync.Mutex),
+		events:    make(map[string]*watcher),
+	}
+}
+
+func (b *bashDriver) Start(p *Provider, u Unit) error {
+	if _, err := command(p.Cmd, localShell); err != nil {
+		return err
+	}
+
+	if !b.remote {
+		return b.runner.Start(p, u)
+	}
+
+	lgr := u.GetContext().Logger()
+	for _, opt := range p.Remote.unsupportedSSHOptions() {
+		lgr.Warnf("ignoring unsupported ssh option %q\n", opt)
+	}
+
+	// Get the code onto the remote host before running it.
+	if err := p.RSync(p.WorkingDir, u); err != nil {
+		return err
+	}
+
+	if err := b.runner.Start(p, u); err != nil {
+		return err
+	}
+
+	// Start a buffered channel
+	w := &watcher{
+		events: make(chan notify.EventInfo, 1),
+		done:   make(chan struct{}),
+	}
+	err := notify.Watch(fmt.Sprintf("%s/...", p.WorkingDir), w.events, notify.All)
+	if err != nil {
+		return errors.New("cannot watch files for the provider")
+	}
+
+	// A unit that's restarted after exiting on its own is still being
+	// watched from before.
+	b.stopWatcher(u)
+	b.eventsMux.Lock()
+	b.events[u.GetName()] = w
+	b.eventsMux.Unlock()
+
+	lgr.Info("started watcher...")
+	go func() {
+		for {
+			select {
+			case e := <-w.events:
+				err := p.ExecuteHandlers(e, u)
+				if err != nil {
+					lgr.Error(err)
+				}
+			case <-w.done:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (b *bashDriver) Stop(p *Provider, u Unit) error {
+	if err := b.runner.Stop(p, u); err != nil {
+		return err
+	}
+
+	// Kill the remote watcher if this is a remote bash script
+	if b.remote {
+		b.stopWatcher(u)
+	}
+	return nil
+}
+
+// stopWatcher stops watching the unit's working directory, if it's being
+// watched.
+func (b *bashDriver) stopWatcher(u Unit) {
+	b.eventsMux.Lock()
+	defer b.eventsMux.Unlock()
+
+	if w, ok := b.events[u.GetName()]; ok {
+		notify.Stop(w.events)
+		close(w.done)
+		delete(b.events, u.GetName())
+	}
+}
+
+func (b *bashDriver) Status(p *Provider, u Unit) (*status.Status, error) {
+	// Processes are tracked by the unit itself from the moment they're
+	// started, unless they were started before we were.
+	if stat := u.GetStatus(); stat != nil {
+		return stat, nil
+	}
+	return b.runner.Attach(p, u)
+}
+
+func (b *bashDriver) Logs(
+	p *Provider,
+	u Unit,
+	opts LogOptions,
+	dataChan chan []byte,
+) (func(), error) {
+	return b.runner.Logs(p, u, opts, dataChan)
+}
+
+func (b *bashDriver) Validate(p *Provider) []error {
+	var errs []error
+	if b.remote {
+		if len(p.Remote.Host) == 0 || len(p.Remote.User) == 0 {
+			errs = append(
+				errs,
+				gerrors.ErrBashRemoteMissingRemote,
+			)
+		}
+		errs = append(errs, p.Remote.validateSSH()...)
+	}
+	if _, err := command(p.Cmd, localShell); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, p.validateStop()...)
+	errs = append(errs, p.validateEnvironment()...)
+	if p.hasContainerFields() {
+		errs = append(errs, gerrors.ErrBashExtraneousFields)
+	}
+	return errs
+}
+
+func (p *Provider) ExecuteHandlers(e notify.EventInfo, u Unit) error {
+	for _, handler := range p.Handlers {
+		var match bool
+		var err error
+		if handler.Match != "" {
+			match, err = regexp.MatchString(handler.Match, e.Path())
+		} else if handler.Exclude != "" {
+			match, err = regexp.MatchString(handler.Exclude, e.Path())
+			// Negate the result since we're excluding files matching this pattern
+			match = !match
+		}
+
+		if err != nil {
+			return err
+		}
+		if match == false {
+			continue
+		}
+
+		switch handler.Type {
+		case "rsync/remote":
+			return p.RSync(e.Path(), u)
+		case "execute/remote":
+			outputFile, err := u.OutputFile()
+			if err != nil {
+				return err
+			}
+
+			sess, err := p.sshClient().NewSession()
+			if err != nil {
+				return err
+			}
+			sess.Stdout = outputFile
+			sess.Stderr = outputFile
+
+			script := fmt.Sprintf("cd %s; %s", p.Remote.remoteWorkingDir(), handler.Cmd)
+			if err := sess.Start(script); err != nil {
+				sess.Close()
+				return err
+			}
+			go func() {
+				_ = sess.Wait()
+				sess.Close()
+			}()
+		default:
+			return errors.New("unknown handler")
+		}
+	}
+
+	return nil
+}
+
+// BashCmd returns the command to run the provider's cmd on this machine.
+func (p *Provider) BashCmd() (*exec.Cmd, error) {
+	args, err := command(p.Cmd, localShell)
+	if err != nil {
+		return nil, err
+	}
+
+	// Relative working directories are resolved against the config
+	// file's directory when it's loaded, which is also where units
+	// without one are run.
+	workingDir := p.WorkingDir
+	if len(workingDir) == 0 {
+		workingDir = p.configDir
+	}
+	if workingDir, err = resolvePath(workingDir, p.configDir); err != nil {
+		return nil, err
+	}
+
+	env, err := p.localEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	c := exec.Command(args[0], args[1:]...)
+	c.Dir = workingDir
+	c.Env = env
+	return c, nil
+}
+
+// RSync copies local, the working directory or a file in it, to the same
+// place in the remote working directory.
+func (p *Provider) RSync(local string, u Unit) error {
+	remoteDir := p.Remote.WorkingDir
+	if local != p.WorkingDir {
+		remoteDir = strings.Replace(local, p.WorkingDir, remoteDir, 1)
+	}
+
+	sent, err := p.sshClient().Sync(local, filepath.ToSlash(remoteDir), []string{"node_modules"})
+	if err != nil {
+		return err
+	}
+
+	u.GetContext().Logger().Debugf(
+		"[unit:%q] synced %d files to %s\n",
+		u.GetName(),
+		len(sent),
+		p.Remote.Host,
+	)
+	return nil
+}
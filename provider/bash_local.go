@@ -0,0 +1,249 @@
+package provider
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/hpcloud/tail"
+	"github.com/ttacon/glorious/status"
+)
+
+// localRunner runs bash/local units as children of the daemon.
+type localRunner struct{}
+
+func (l localRunner) Start(p *Provider, u Unit) error {
+	c, err := p.BashCmd()
+	if err != nil {
+		return err
+	}
+	setProcessGroup(c)
+
+	outputFile, err := u.OutputFile()
+	if err != nil {
+		return err
+	}
+
+	c.Stdout = outputFile
+	c.Stderr = outputFile
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	// Purge the PID file to disk
+	if err := u.SavePIDFile(c); err != nil {
+		// TODO(ttacon): we'll need to cleanup here
+		return err
+	}
+
+	u.SetRunningStatus(status.NewRunningStatus(
+		c,
+		outputFile,
+	), func(stat *status.Status) {
+		go func(stat *status.Status) {
+			stat.WaitForCommandEnd()
+			if err := u.RemovePIDFile(); err != nil {
+				u.GetContext().Logger().Error(err)
+			}
+			u.ProcessExited(stat)
+		}(stat)
+	})
+
+	u.GetContext().Logger().Infof("begun as pid %d...\n", c.Process.Pid)
+
+	return nil
+}
+
+func (l localRunner) Stop(p *Provider, u Unit) error {
+	stat := u.GetStatus()
+
+	// It's possible to be beaten here by the goroutine that is
+	// waiting on the process to exit, so safety belts!
+	if stat.Cmd == nil {
+		return nil
+	}
+
+	sig, err := p.stopSignal()
+	if err != nil {
+		return err
+	}
+	grace, err := p.stopGracePeriod()
+	if err != nil {
+		return err
+	}
+
+	if err := terminate(stat.Cmd.Process.Pid, sig, grace); err != nil {
+		return err
+	}
+
+	if err := stat.OutFile.Close(); err != nil {
+		return err
+	}
+
+	stat.Cmd.Stdout = nil
+	stat.Cmd.Stderr = nil
+	return nil
+}
+
+// pidPollInterval is how often a reattached process is checked on, as we
+// can't wait on a process that isn't our child.
+var pidPollInterval = time.Second
+
+// Attach picks up a process started by a previous daemon, from the unit's
+// PID file, if it is still running.
+func (l localRunner) Attach(p *Provider, u Unit) (*status.Status, error) {
+	lgr := u.GetContext().Logger()
+
+	pidFile, err := u.ReadPIDFile()
+	if err != nil {
+		lgr.Debug("removing unreadable pid file: ", err)
+		return nil, u.RemovePIDFile()
+	} else if pidFile == nil {
+		return nil, nil
+	}
+
+	if !pidFile.Running() {
+		lgr.Debugf("[unit:%q] pid %d is no longer running\n", u.GetName(), pidFile.PID)
+		return nil, u.RemovePIDFile()
+	}
+
+	proc, err := os.FindProcess(pidFile.PID)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFile, err := u.OutputFile()
+	if err != nil {
+		return nil, err
+	}
+
+	stat := status.NewRunningStatus(&exec.Cmd{
+		Path:    pidFile.Path,
+		Args:    pidFile.Args,
+		Process: proc,
+	}, outputFile)
+
+	go func() {
+		for pidFile.Running() {
+			time.Sleep(pidPollInterval)
+		}
+
+		// We don't get to know how the process exited, so anything
+		// we didn't stop counts as a failure.
+		stat.CommandEnded(-1, true)
+		if err := u.RemovePIDFile(); err != nil {
+			lgr.Error(err)
+		}
+		u.ProcessExited(stat)
+	}()
+
+	lgr.Infof("[unit:%q] reattached to pid %d\n", u.GetName(), pidFile.PID)
+	return stat, nil
+}
+
+func (l localRunner) Logs(
+	p *Provider,
+	u Unit,
+	opts LogOptions,
+	dataChan chan []byte,
+) (func(), error) {
+	stat := u.GetStatus()
+	if stat == nil || stat.OutFile == nil {
+		return nil, errors.New("cannot tail a stopped process")
+	}
+	fileName := stat.OutFile.Name()
+
+	var offset int64
+	if opts.Lines > 0 {
+		var err error
+		if offset, err = lastLinesOffset(fileName, opts.Lines); err != nil {
+			return nil, err
+		}
+	}
+
+	t, err := tail.TailFile(fileName, tail.Config{
+		Follow:   opts.Follow,
+		Location: &tail.SeekInfo{Offset: offset},
+		Logger:   tail.DiscardingLogger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer close(dataChan)
+
+		for line := range t.Lines {
+			dataChan <- []byte(line.Text)
+		}
+	}()
+
+	// Stopping reads on to the end of the file, so output that a unit
+	// wrote just before it exited isn't lost. This blocks until it's all
+	// been sent, so it's done in the background.
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			go func() {
+				_ = t.StopAtEOF()
+				t.Cleanup()
+			}()
+		})
+	}, nil
+}
+
+// lastLinesOffset returns the offset in the file at which the last n lines
+// begin.
+func lastLinesOffset(fileName string, n int) (int64, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		end   = info.Size()
+		buf   = make([]byte, 4096)
+		found = 0
+	)
+	for end > 0 {
+		size := int64(len(buf))
+		if end < size {
+			size = end
+		}
+		start := end - size
+
+		if _, err := f.ReadAt(buf[:size], start); err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		for i := size - 1; i >= 0; i-- {
+			if buf[i] != '\n' {
+				continue
+			}
+
+			// A trailing newline terminates the last line, it
+			// doesn't start a new one.
+			if start+i == info.Size()-1 {
+				continue
+			}
+
+			found++
+			if found == n {
+				return start + i + 1, nil
+			}
+		}
+		end = start
+	}
+
+	return 0, nil
+}
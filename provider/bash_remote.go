@@ -0,0 +1,326 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ttacon/glorious/remote"
+	"github.com/ttacon/glorious/status"
+)
+
+// remoteRunner runs bash/remote units detached on the remote host. Their PID,
+// exit code and output are kept on the remote host as well, so that they
+// outlive the ssh connection that started them and can be found again.
+type remoteRunner struct{}
+
+// remotePollInterval is how often remote units are checked on.
+var remotePollInterval = 2 * time.Second
+
+// remoteLogsStopTimeout is how long a remote tail -f has to exit once it's
+// been stopped, after which its session is closed anyway.
+var remoteLogsStopTimeout = 5 * time.Second
+
+// remotePath returns the path of one of the unit's files on the remote host,
+// quoted for use in a remote shell script.
+func remotePath(dir string, u Unit) string {
+	return `"$HOME/.glorious/` + dir + `/"` + remote.Quote(u.GetName())
+}
+
+// remoteWorkingDir returns the directory to run remote commands in, quoted
+// for use in a remote shell script. It's the remote user's home directory
+// if none is given.
+func (r RemoteInfo) remoteWorkingDir() string {
+	if len(r.WorkingDir) == 0 {
+		return remote.QuotePath("~")
+	}
+	return remote.QuotePath(r.WorkingDir)
+}
+
+func (r remoteRunner) Start(p *Provider, u Unit) error {
+	envFile, err := p.writeRemoteEnv(u)
+	if err != nil {
+		return err
+	}
+	script, err := p.remoteStartScript(u, envFile)
+	if err != nil {
+		return err
+	}
+
+	if out, err := p.sshClient().CombinedOutput(script); err != nil {
+		return fmt.Errorf("failed to start remote process: %s: %s", err, bytes.TrimSpace(out))
+	}
+
+	u.SetRunningStatus(
+		status.NewRunningStatus(nil, nil),
+		func(stat *status.Status) {
+			go r.watch(p, u, stat)
+		},
+	)
+
+	u.GetContext().Logger().Infof("begun on %s...\n", p.Remote.Host)
+	return nil
+}
+
+// remoteStartScript returns the script that starts the unit detached on the
+// remote host, with the environment sourced from envFile.
+func (p *Provider) remoteStartScript(u Unit, envFile string) (string, error) {
+	var (
+		pidFile  = remotePath("state/pid-files", u)
+		exitFile = remotePath("state/exit-codes", u)
+		logFile  = remotePath("output", u)
+	)
+
+	// The command is run by a shell that records its exit code. Where
+	// setsid is available, it gets its own session so that everything it
+	// starts can be stopped with it.
+	cmd, err := p.remoteCommand(envFile)
+	if err != nil {
+		return "", err
+	}
+	wrapper := fmt.Sprintf(
+		"(cd %s && %s); echo $? > %s",
+		p.Remote.remoteWorkingDir(),
+		cmd,
+		exitFile,
+	)
+	return fmt.Sprintf(`mkdir -p "$HOME/.glorious/state/pid-files" "$HOME/.glorious/state/exit-codes" "$HOME/.glorious/output"
+rm -f %[2]s
+detach=
+command -v setsid >/dev/null 2>&1 && detach=setsid
+nohup $detach sh -c %[4]s >> %[3]s 2>&1 < /dev/null &
+echo $! > %[1]s`,
+		pidFile,
+		exitFile,
+		logFile,
+		remote.Quote(wrapper),
+	), nil
+}
+
+// watch polls the remote process until it exits, or is stopped by us. Failed
+// polls are retried, so a dropped connection doesn't count as a crash.
+func (r remoteRunner) watch(p *Provider, u Unit, stat *status.Status) {
+	lgr := u.GetContext().Logger()
+
+	for {
+		time.Sleep(remotePollInterval)
+		if !stat.IsRunning() {
+			return
+		}
+
+		state, err := p.remoteState(u)
+		if err != nil {
+			lgr.Debugf("[unit:%q] failed to check remote process: %s\n", u.GetName(), err)
+			continue
+		}
+
+		switch state.state {
+		case remoteRunning:
+			continue
+		case remoteExited:
+			stat.CommandEnded(state.exitCode, state.exitCode != 0)
+		default:
+			// We don't get to know how the process exited, so
+			// anything we didn't stop counts as a failure.
+			stat.CommandEnded(-1, true)
+		}
+
+		u.ProcessExited(stat)
+		return
+	}
+}
+
+const (
+	remoteRunning = "running"
+	remoteExited  = "exited"
+	remoteGone    = "gone"
+)
+
+type remoteProcessState struct {
+	state    string
+	exitCode int
+}
+
+// remoteState checks on the unit's process on the remote host.
+func (p *Provider) remoteState(u Unit) (remoteProcessState, error) {
+	script := fmt.Sprintf(`pid=$(cat %[1]s 2>/dev/null) || { echo %[3]s; exit 0; }
+if [ -f %[2]s ]; then echo "%[4]s $(cat %[2]s)"
+elif kill -0 $pid 2>/dev/null; then echo %[5]s
+else echo %[3]s; fi`,
+		remotePath("state/pid-files", u),
+		remotePath("state/exit-codes", u),
+		remoteGone,
+		remoteExited,
+		remoteRunning,
+	)
+
+	out, err := p.sshClient().Output(script)
+	if err != nil {
+		return remoteProcessState{}, err
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return remoteProcessState{}, fmt.Errorf("unexpected response %q", out)
+	}
+
+	state := remoteProcessState{state: fields[0]}
+	if state.state == remoteExited && len(fields) > 1 {
+		if state.exitCode, err = strconv.Atoi(fields[1]); err != nil {
+			state.exitCode = -1
+		}
+	}
+	return state, nil
+}
+
+func (r remoteRunner) Stop(p *Provider, u Unit) error {
+	grace, err := p.stopGracePeriod()
+	if err != nil {
+		return err
+	}
+
+	if err := p.stopRemote(u, grace); err != nil {
+		return err
+	}
+
+	u.GetStatus().Stop()
+	return nil
+}
+
+// stopRemote stops a bash/remote unit on the remote host, in the same way
+// that local units are stopped.
+func (p *Provider) stopRemote(u Unit, grace time.Duration) error {
+	var (
+		pidFile = remotePath("state/pid-files", u)
+		envFile = remotePath("state/env", u)
+		polls   = int(grace / stopPollInterval)
+	)
+
+	// Stop the whole process group if the process leads one.
+	script := fmt.Sprintf(`rm -f %[5]s
+pid=$(cat %[1]s 2>/dev/null) || exit 0
+target=-$pid
+kill -0 $target 2>/dev/null || target=$pid
+kill -%[2]s $target 2>/dev/null || { rm -f %[1]s; exit 0; }
+i=0
+while kill -0 $target 2>/dev/null; do
+  if [ $i -ge %[3]d ]; then kill -KILL $target; break; fi
+  sleep %[4]s; i=$((i+1))
+done
+rm -f %[1]s`,
+		pidFile,
+		p.stopSignalName(),
+		polls,
+		strconv.FormatFloat(stopPollInterval.Seconds(), 'f', -1, 64),
+		envFile,
+	)
+
+	if out, err := p.sshClient().CombinedOutput(script); err != nil {
+		return fmt.Errorf("failed to stop remote process: %s: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// Attach finds the unit's process on the remote host, if it is still
+// running. Hosts that can't be reached are treated as having nothing
+// running, so that they don't stop the daemon from starting.
+func (r remoteRunner) Attach(p *Provider, u Unit) (*status.Status, error) {
+	lgr := u.GetContext().Logger()
+
+	state, err := p.remoteState(u)
+	if err != nil {
+		lgr.Debugf("[unit:%q] failed to check remote process: %s\n", u.GetName(), err)
+		return nil, nil
+	} else if state.state != remoteRunning {
+		return nil, nil
+	}
+
+	stat := status.NewRunningStatus(nil, nil)
+	go r.watch(p, u, stat)
+
+	lgr.Infof("[unit:%q] reattached to remote process on %s\n", u.GetName(), p.Remote.Host)
+	return stat, nil
+}
+
+func (r remoteRunner) Logs(
+	p *Provider,
+	u Unit,
+	opts LogOptions,
+	dataChan chan []byte,
+) (func(), error) {
+	lines := "+1"
+	if opts.Lines > 0 {
+		lines = strconv.Itoa(opts.Lines)
+	}
+
+	args := []string{"tail", "-n", lines}
+	if opts.Follow {
+		args = append(args, "-f")
+	}
+	args = append(args, remotePath("output", u))
+	script := strings.Join(args, " ")
+
+	sess, err := p.sshClient().NewSession()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := sess.StdoutPipe()
+	if err != nil {
+		sess.Close()
+		return nil, err
+	}
+
+	// Closing the session doesn't stop tail -f on the other end, so it's
+	// killed once we close our end of its stdin instead.
+	var stdin io.WriteCloser
+	if opts.Follow {
+		if stdin, err = sess.StdinPipe(); err != nil {
+			sess.Close()
+			return nil, err
+		}
+		script += " & pid=$!; cat >/dev/null; kill $pid"
+	}
+
+	if err := sess.Start(script); err != nil {
+		sess.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(dataChan)
+		defer close(done)
+
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			line := make([]byte, len(scanner.Bytes()))
+			copy(line, scanner.Bytes())
+			dataChan <- line
+		}
+		_ = sess.Wait()
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if stdin == nil {
+				_ = sess.Close()
+				return
+			}
+
+			_ = stdin.Close()
+			go func() {
+				select {
+				case <-done:
+				case <-time.After(remoteLogsStopTimeout):
+				}
+				_ = sess.Close()
+			}()
+		})
+	}, nil
+}
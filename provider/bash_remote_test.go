@@ -0,0 +1,532 @@
+//go:build !windows
+// +build !windows
+
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ttacon/glorious/remote"
+	"github.com/ttacon/glorious/remote/remotetest"
+	"github.com/ttacon/glorious/status"
+)
+
+// testRemote starts an ssh server that runs remote commands locally, with a
+// temporary directory as the remote home directory, and returns the remote
+// info to connect to it.
+func testRemote(t *testing.T) (RemoteInfo, func()) {
+	dir, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := remotetest.NewServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		identityFile   = filepath.Join(dir, "id_ecdsa")
+		knownHostsFile = filepath.Join(dir, "known_hosts")
+	)
+	if err := srv.WriteClientKey(identityFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddToKnownHosts(knownHostsFile); err != nil {
+		t.Fatal(err)
+	}
+
+	oldRemotePollInterval := remotePollInterval
+	remotePollInterval = 20 * time.Millisecond
+
+	info := RemoteInfo{
+		Host:         srv.Host(),
+		Port:         srv.Port(),
+		User:         "glorious",
+		IdentityFile: identityFile,
+		WorkingDir:   dir,
+		SSHOptions:   []string{"UserKnownHostsFile=" + knownHostsFile},
+	}
+	return info, func() {
+		remotePollInterval = oldRemotePollInterval
+		remote.Get(info.sshConfig()).Close()
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRemoteRunner(t *testing.T) {
+	remoteInfo, cleanup := testRemote(t)
+	defer cleanup()
+
+	var (
+		r = remoteRunner{}
+		u = &fakeUnit{exited: make(chan *status.Status, 1)}
+		p = &Provider{
+			Type:            "bash/remote",
+			Cmd:             "echo hello; sleep 30",
+			StopGracePeriod: "1s",
+			Remote:          remoteInfo,
+		}
+	)
+
+	if err := r.Start(p, u); err != nil {
+		t.Fatal("failed to start: ", err)
+	}
+
+	state, err := p.remoteState(u)
+	if err != nil {
+		t.Fatal(err)
+	} else if state.state != remoteRunning {
+		t.Fatal("expected remote process to be running, got: ", state.state)
+	}
+
+	// A new daemon should find it again.
+	if stat, err := r.Attach(p, u); err != nil || stat == nil {
+		t.Error("expected to reattach to remote process: ", err)
+	}
+
+	dataChan := make(chan []byte, 5)
+	stop, err := r.Logs(p, u, LogOptions{}, dataChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for line := range dataChan {
+		lines = append(lines, string(line))
+	}
+	stop()
+	if len(lines) != 1 || lines[0] != "hello" {
+		t.Error("unexpected log lines: ", lines)
+	}
+
+	if err := r.Stop(p, u); err != nil {
+		t.Fatal("failed to stop: ", err)
+	}
+
+	if state, err := p.remoteState(u); err != nil {
+		t.Error(err)
+	} else if state.state != remoteGone {
+		t.Error("expected remote process to be gone, got: ", state.state)
+	}
+	if u.stat.CurrentStatus != status.Stopped {
+		t.Error("expected unit to be stopped, got: ", u.stat)
+	}
+
+	// The reattached status should notice that the process is gone too.
+	select {
+	case <-u.exited:
+	case <-time.After(2 * time.Second):
+		t.Error("reattached status never noticed the process stopping")
+	}
+}
+
+func TestRemoteRunnerExit(t *testing.T) {
+	remoteInfo, cleanup := testRemote(t)
+	defer cleanup()
+
+	var (
+		r = remoteRunner{}
+		u = &fakeUnit{exited: make(chan *status.Status, 1)}
+		p = &Provider{
+			Type:   "bash/remote",
+			Cmd:    "sleep 0.1; exit 3",
+			Remote: remoteInfo,
+		}
+	)
+
+	// fakeUnit doesn't run the callback, so watch it ourselves.
+	if err := r.Start(p, u); err != nil {
+		t.Fatal("failed to start: ", err)
+	}
+	go r.watch(p, u, u.stat)
+
+	select {
+	case stat := <-u.exited:
+		stat.Lock()
+		if stat.CurrentStatus != status.Crashed || stat.ExitCode != 3 {
+			t.Errorf("expected unit to crash with exit code 3, got %s (%d)", stat, stat.ExitCode)
+		}
+		stat.Unlock()
+	case <-time.After(2 * time.Second):
+		t.Fatal("remote exit was never noticed")
+	}
+}
+
+func TestRemoteRunnerWorkingDirWithSpaces(t *testing.T) {
+	remoteInfo, cleanup := testRemote(t)
+	defer cleanup()
+
+	remoteInfo.WorkingDir = filepath.Join(remoteInfo.WorkingDir, "my app")
+	if err := os.Mkdir(remoteInfo.WorkingDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		r = remoteRunner{}
+		u = &fakeUnit{exited: make(chan *status.Status, 1)}
+		p = &Provider{
+			Type:   "bash/remote",
+			Cmd:    "pwd",
+			Remote: remoteInfo,
+		}
+	)
+
+	if err := r.Start(p, u); err != nil {
+		t.Fatal("failed to start: ", err)
+	}
+	go r.watch(p, u, u.stat)
+
+	select {
+	case stat := <-u.exited:
+		stat.Lock()
+		if stat.ExitCode != 0 {
+			t.Error("expected the command to succeed, got exit code: ", stat.ExitCode)
+		}
+		stat.Unlock()
+	case <-time.After(2 * time.Second):
+		t.Fatal("remote exit was never noticed")
+	}
+
+	dataChan := make(chan []byte, 5)
+	stop, err := r.Logs(p, u, LogOptions{}, dataChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for line := range dataChan {
+		lines = append(lines, string(line))
+	}
+	stop()
+	if len(lines) != 1 || lines[0] != remoteInfo.WorkingDir {
+		t.Error("expected the command to run in the working dir, got: ", lines)
+	}
+}
+
+func TestBashDriverStopsWatcher(t *testing.T) {
+	remoteInfo, cleanup := testRemote(t)
+	defer cleanup()
+
+	local, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+
+	remoteInfo.WorkingDir = filepath.Join(remoteInfo.WorkingDir, "app")
+
+	var (
+		b = newBashDriver(true)
+		u = &fakeUnit{}
+		p = &Provider{
+			Type:            "bash/remote",
+			Cmd:             "sleep 30",
+			WorkingDir:      local,
+			StopGracePeriod: "1s",
+			Remote:          remoteInfo,
+		}
+	)
+
+	if err := b.Start(p, u); err != nil {
+		t.Fatal("failed to start: ", err)
+	}
+	w, ok := b.events[u.GetName()]
+	if !ok {
+		t.Fatal("expected the working dir to be watched")
+	}
+
+	if err := b.Stop(p, u); err != nil {
+		t.Fatal("failed to stop: ", err)
+	}
+	if _, ok := b.events[u.GetName()]; ok {
+		t.Error("expected the watcher to be forgotten")
+	}
+	select {
+	case <-w.done:
+	default:
+		t.Error("expected the watcher's handlers to be stopped")
+	}
+}
+
+func TestProviderRSync(t *testing.T) {
+	remoteInfo, cleanup := testRemote(t)
+	defer cleanup()
+
+	local, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+
+	if err := os.Mkdir(filepath.Join(local, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(local, "src", "app.js"), []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	remoteDir := filepath.Join(remoteInfo.WorkingDir, "app")
+	remoteInfo.WorkingDir = remoteDir
+
+	var (
+		u = &fakeUnit{}
+		p = &Provider{
+			Type:       "bash/remote",
+			WorkingDir: local,
+			Remote:     remoteInfo,
+		}
+	)
+
+	if err := p.RSync(local, u); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes to a single file should land in the same place.
+	changed := filepath.Join(local, "src", "app.js")
+	if err := ioutil.WriteFile(changed, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RSync(changed, u); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(remoteDir, "src", "app.js"))
+	if err != nil {
+		t.Fatal(err)
+	} else if string(got) != "v2" {
+		t.Errorf("expected %q, got %q\n", "v2", got)
+	}
+}
+
+func TestCommandFormsLocalAndRemote(t *testing.T) {
+	remoteInfo, cleanup := testRemote(t)
+	defer cleanup()
+
+	var tests = []struct {
+		cmd      interface{}
+		expected string
+	}{
+		{"GREETING='hello  there' sh -c 'echo \"$GREETING\"' | tr a-z A-Z", "HELLO  THERE"},
+		{"false || echo recovered", "recovered"},
+		{[]interface{}{"echo", "$HOME", "it's"}, "$HOME it's"},
+	}
+
+	for i, test := range tests {
+		p := &Provider{Cmd: test.cmd, WorkingDir: remoteInfo.WorkingDir, Remote: remoteInfo}
+
+		c, err := p.BashCmd()
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		}
+		local, err := c.Output()
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		}
+
+		script, err := remoteScript(test.cmd)
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		}
+		remote, err := p.sshClient().Output(script)
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		}
+
+		if got := strings.TrimSpace(string(local)); got != test.expected {
+			t.Errorf("[test %d] expected %q locally, got %q\n", i, test.expected, got)
+		}
+		if got := strings.TrimSpace(string(remote)); got != test.expected {
+			t.Errorf("[test %d] expected %q remotely, got %q\n", i, test.expected, got)
+		}
+	}
+}
+
+func TestEnvironmentLocalAndRemote(t *testing.T) {
+	remoteInfo, cleanup := testRemote(t)
+	defer cleanup()
+
+	envFile := filepath.Join(remoteInfo.WorkingDir, ".env")
+	if err := ioutil.WriteFile(envFile, []byte("GREETING='hello there'\nNAME=file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		provider Provider
+		expected string
+	}{
+		{
+			Provider{
+				Cmd:         `echo "$GREETING, $NAME"`,
+				EnvFile:     []string{envFile},
+				Environment: []string{"NAME=list"},
+			},
+			"hello there, list",
+		},
+		// The parent environment is passed on, unless it's cleared.
+		{Provider{Cmd: `echo "[$HOME]"`}, "[" + remoteInfo.WorkingDir + "]"},
+		{Provider{Cmd: `echo "[$HOME]"`, ClearEnvironment: true}, "[]"},
+	}
+
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", remoteInfo.WorkingDir)
+	defer os.Setenv("HOME", oldHome)
+
+	for i, test := range tests {
+		p := &test.provider
+		p.WorkingDir = remoteInfo.WorkingDir
+		p.Remote = remoteInfo
+
+		c, err := p.BashCmd()
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		}
+		local, err := c.Output()
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		}
+
+		envFile, err := p.writeRemoteEnv(&fakeUnit{})
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		}
+		script, err := p.remoteCommand(envFile)
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		}
+		remote, err := p.sshClient().Output(script)
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		}
+
+		if got := strings.TrimSpace(string(local)); got != test.expected {
+			t.Errorf("[test %d] expected %q locally, got %q\n", i, test.expected, got)
+		}
+		if got := strings.TrimSpace(string(remote)); got != test.expected {
+			t.Errorf("[test %d] expected %q remotely, got %q\n", i, test.expected, got)
+		}
+	}
+}
+
+func TestRemoteRunnerEnvironmentNotInScript(t *testing.T) {
+	remoteInfo, cleanup := testRemote(t)
+	defer cleanup()
+
+	var tests = []Provider{
+		{Cmd: `echo "$SECRET"`, Environment: []string{"SECRET=hunter2 it's"}},
+		{Cmd: `echo "$SECRET"`, Environment: []string{"SECRET=hunter2 it's"}, ClearEnvironment: true},
+	}
+
+	for i := range tests {
+		var (
+			r = remoteRunner{}
+			u = &fakeUnit{exited: make(chan *status.Status, 1)}
+			p = &tests[i]
+		)
+		p.Type = "bash/remote"
+		p.Remote = remoteInfo
+
+		envFile, err := p.writeRemoteEnv(u)
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		}
+		script, err := p.remoteStartScript(u, envFile)
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		} else if strings.Contains(script, "hunter2") {
+			t.Errorf("[test %d] expected no values in the script, got: %s\n", i, script)
+		}
+
+		info, err := os.Stat(filepath.Join(remoteInfo.WorkingDir, ".glorious", "state", "env", u.GetName()))
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		} else if info.Mode().Perm() != 0600 {
+			t.Errorf("[test %d] expected the env file to be private, got %s\n", i, info.Mode())
+		}
+
+		if err := r.Start(p, u); err != nil {
+			t.Fatalf("[test %d] failed to start: %s\n", i, err)
+		}
+		go r.watch(p, u, u.stat)
+		select {
+		case <-u.exited:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("[test %d] remote exit was never noticed\n", i)
+		}
+
+		dataChan := make(chan []byte, 5)
+		stop, err := r.Logs(p, u, LogOptions{Lines: 1}, dataChan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		for line := range dataChan {
+			lines = append(lines, string(line))
+		}
+		stop()
+		if len(lines) != 1 || lines[0] != "hunter2 it's" {
+			t.Errorf("[test %d] expected the unit to see its environment, got: %q\n", i, lines)
+		}
+	}
+}
+
+func TestRemoteRunnerLogsFollowStop(t *testing.T) {
+	remoteInfo, cleanup := testRemote(t)
+	defer cleanup()
+
+	var (
+		r = remoteRunner{}
+		u = &fakeUnit{exited: make(chan *status.Status, 1)}
+		p = &Provider{
+			Type:            "bash/remote",
+			Cmd:             "echo hello; sleep 30",
+			StopGracePeriod: "1s",
+			Remote:          remoteInfo,
+		}
+	)
+
+	if err := r.Start(p, u); err != nil {
+		t.Fatal("failed to start: ", err)
+	}
+	defer r.Stop(p, u)
+
+	dataChan := make(chan []byte, 5)
+	stop, err := r.Logs(p, u, LogOptions{Follow: true}, dataChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case line := <-dataChan:
+		if string(line) != "hello" {
+			t.Error("unexpected log line: ", string(line))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the unit's output")
+	}
+
+	// Stopping the follow takes the remote tail with it.
+	stop()
+	select {
+	case _, ok := <-dataChan:
+		if ok {
+			t.Error("expected no more lines")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the logs to end once stopped")
+	}
+
+	outputFile := filepath.Join(remoteInfo.WorkingDir, ".glorious", "output", u.GetName())
+	deadline := time.Now().Add(2 * time.Second)
+	for exec.Command("pgrep", "-f", "tail .*"+outputFile).Run() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the remote tail to have exited")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,169 @@
+package provider
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	gcontext "github.com/ttacon/glorious/context"
+	"github.com/ttacon/glorious/status"
+	"github.com/ttacon/glorious/store"
+)
+
+type fakeUnit struct {
+	stat          *status.Status
+	pidFile       *PIDFile
+	exited        chan *status.Status
+	forceRecreate bool
+	progress      []string
+}
+
+func (f *fakeUnit) GetName() string     { return "fake" }
+func (f *fakeUnit) ForceRecreate() bool { return f.forceRecreate }
+func (f *fakeUnit) ReportProgress(message string) {
+	f.progress = append(f.progress, message)
+}
+func (f *fakeUnit) SetRunningStatus(s *status.Status, cb status.StatusCallback) {
+	f.stat = s
+}
+func (f *fakeUnit) GetStatus() *status.Status      { return f.stat }
+func (f *fakeUnit) OutputFile() (*os.File, error)  { return nil, nil }
+func (f *fakeUnit) SavePIDFile(c *exec.Cmd) error  { return nil }
+func (f *fakeUnit) ReadPIDFile() (*PIDFile, error) { return f.pidFile, nil }
+func (f *fakeUnit) RemovePIDFile() error           { f.pidFile = nil; return nil }
+func (f *fakeUnit) InternalStore() *store.Store    { return nil }
+func (f *fakeUnit) GetContext() gcontext.Context   { return testContext{} }
+func (f *fakeUnit) ProcessExited(s *status.Status) {
+	if f.exited != nil {
+		f.exited <- s
+	}
+}
+
+type testContext struct{}
+
+func (c testContext) InternalStore() *store.Store { return nil }
+func (c testContext) Logger() gcontext.Logger {
+	lgr := logrus.New()
+	lgr.SetOutput(ioutil.Discard)
+	return lgr
+}
+
+func TestLastLinesOffset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var tests = []struct {
+		contents string
+		lines    int
+		expected string
+	}{
+		{"one\ntwo\nthree\n", 2, "two\nthree\n"},
+		{"one\ntwo\nthree", 2, "two\nthree"},
+		{"one\ntwo\nthree\n", 5, "one\ntwo\nthree\n"},
+		{"one\ntwo\nthree\n", 1, "three\n"},
+		{"", 3, ""},
+	}
+
+	for i, test := range tests {
+		fileName := filepath.Join(dir, "output")
+		if err := ioutil.WriteFile(fileName, []byte(test.contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		offset, err := lastLinesOffset(fileName, test.lines)
+		if err != nil {
+			t.Errorf("[test %d] unexpected error: %s\n", i, err)
+		} else if got := test.contents[offset:]; got != test.expected {
+			t.Errorf("[test %d] expected %q, got %q\n", i, test.expected, got)
+		}
+	}
+}
+
+func TestBashDriverLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := os.Create(filepath.Join(dir, "output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString("one\ntwo\nthree\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	u := &fakeUnit{stat: status.NewRunningStatus(nil, f)}
+	dataChan := make(chan []byte, 10)
+	stop, err := newBashDriver(false).Logs(
+		&Provider{Type: "bash/local"},
+		u,
+		LogOptions{Lines: 2},
+		dataChan,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	var lines []string
+	for line := range dataChan {
+		lines = append(lines, string(line))
+	}
+	if len(lines) != 2 || lines[0] != "two" || lines[1] != "three" {
+		t.Error("unexpected lines: ", lines)
+	}
+}
+
+func TestBashDriverLogsAfterExit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := os.Create(filepath.Join(dir, "output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	u := &fakeUnit{stat: status.NewRunningStatus(nil, f)}
+	dataChan := make(chan []byte)
+	stop, err := newBashDriver(false).Logs(
+		&Provider{Type: "bash/local"},
+		u,
+		LogOptions{Follow: true},
+		dataChan,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The unit writes its output and exits straight away, so the logs
+	// are stopped before much, if any, of it has been read.
+	const numLines = 1000
+	for i := 0; i < numLines; i++ {
+		if _, err := fmt.Fprintf(f, "line %d\n", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop()
+
+	var lines []string
+	for line := range dataChan {
+		lines = append(lines, string(line))
+	}
+	if len(lines) != numLines || lines[numLines-1] != "line 999" {
+		t.Errorf("expected all %d lines, got %d\n", numLines, len(lines))
+	}
+}
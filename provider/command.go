@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+
+	gerrors "github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/remote"
+)
+
+var (
+	// remoteShell runs shell form commands on remote hosts.
+	remoteShell = []string{"/bin/sh", "-c"}
+
+	// localShell runs shell form commands on this machine.
+	localShell = remoteShell
+)
+
+func init() {
+	if runtime.GOOS == "windows" {
+		localShell = []string{"cmd", "/S", "/C"}
+	}
+}
+
+// command returns the arguments to run cmd with. As with a Dockerfile's CMD,
+// cmd is either a list of arguments that are run as they are (the exec form),
+// or a string that is run by shell (the shell form).
+func command(cmd interface{}, shell []string) ([]string, error) {
+	var args []string
+	switch c := cmd.(type) {
+	case nil:
+	case string:
+		if len(strings.TrimSpace(c)) > 0 {
+			args = append(append(args, shell...), c)
+		}
+	case []string:
+		args = c
+	case []interface{}:
+		for _, arg := range c {
+			s, ok := arg.(string)
+			if !ok {
+				return nil, gerrors.ErrBashInvalidCommand
+			}
+			args = append(args, s)
+		}
+	default:
+		return nil, gerrors.ErrBashInvalidCommand
+	}
+
+	if len(args) == 0 {
+		return nil, gerrors.ErrBashMissingCommand
+	}
+	return args, nil
+}
+
+// remoteScript returns cmd as a script for the remote host's shell.
+func remoteScript(cmd interface{}) (string, error) {
+	args, err := command(cmd, remoteShell)
+	if err != nil {
+		return "", err
+	}
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = remote.Quote(arg)
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// remoteCommand returns the provider's cmd as a script for the remote host's
+// shell, run with the environment that's sourced from envFile, a quoted path
+// on the remote host as returned by writeRemoteEnv. Without an envFile, the
+// remote shell's own environment is used.
+func (p *Provider) remoteCommand(envFile string) (string, error) {
+	script, err := remoteScript(p.Cmd)
+	if err != nil {
+		return "", err
+	}
+	if len(envFile) == 0 {
+		return script, nil
+	}
+
+	// The variables are sourced rather than passed as arguments, which
+	// anyone on the remote host could see with ps. Without the parent
+	// environment $HOME isn't set either, so the file is passed in $0.
+	if p.ClearEnvironment {
+		load := `set -a; . "$0"; set +a; ` + script
+		return "env -i /bin/sh -c " + remote.Quote(load) + " " + envFile, nil
+	}
+	return "{ set -a; . " + envFile + "; set +a; " + script + "; }", nil
+}
+
+// remoteEnv returns the provider's environment as a file for the remote
+// host's shell to source. The environment is built here and then passed on,
+// so env files are read from this machine.
+func (p *Provider) remoteEnv() ([]byte, error) {
+	env, err := p.environment(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, v := range env {
+		i := strings.Index(v, "=")
+		buf.WriteString(v[:i] + "=" + remote.Quote(v[i+1:]) + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// writeRemoteEnv writes the provider's environment to a file on the remote
+// host that only the remote user can read, and returns its quoted path for
+// remoteCommand. There's no file, and the path is empty, if there's nothing
+// to change about the remote shell's environment.
+func (p *Provider) writeRemoteEnv(u Unit) (string, error) {
+	env, err := p.remoteEnv()
+	if err != nil {
+		return "", err
+	} else if len(env) == 0 && !p.ClearEnvironment {
+		return "", nil
+	}
+
+	envFile := remotePath("state/env", u)
+	script := fmt.Sprintf(`umask 077
+mkdir -p "$HOME/.glorious/state/env"
+cat > %s`, envFile)
+
+	var stderr bytes.Buffer
+	if err := p.sshClient().Run(script, bytes.NewReader(env), nil, &stderr); err != nil {
+		return "", fmt.Errorf("failed to write remote environment: %s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return envFile, nil
+}
+
+// shellScript returns the script that args runs, if it runs one with
+// /bin/sh -c.
+func shellScript(args []string) (string, bool) {
+	if len(args) != 3 || args[0] != remoteShell[0] || args[1] != remoteShell[1] {
+		return "", false
+	}
+	return args[2], true
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ttacon/glorious/errors"
+)
+
+func TestCommand(t *testing.T) {
+	var tests = []struct {
+		cmd         interface{}
+		expected    []string
+		expectedErr error
+	}{
+		{"npm run start", []string{"/bin/sh", "-c", "npm run start"}, nil},
+		{"PORT=3000 npm start | tee log", []string{"/bin/sh", "-c", "PORT=3000 npm start | tee log"}, nil},
+		{[]interface{}{"npm", "run", "start"}, []string{"npm", "run", "start"}, nil},
+		{[]interface{}{"echo", "two  spaces"}, []string{"echo", "two  spaces"}, nil},
+		{[]string{"./server"}, []string{"./server"}, nil},
+		{nil, nil, errors.ErrBashMissingCommand},
+		{"  ", nil, errors.ErrBashMissingCommand},
+		{[]interface{}{}, nil, errors.ErrBashMissingCommand},
+		{[]interface{}{"sleep", 30}, nil, errors.ErrBashInvalidCommand},
+		{30, nil, errors.ErrBashInvalidCommand},
+	}
+
+	for i, test := range tests {
+		args, err := command(test.cmd, remoteShell)
+		if err != test.expectedErr {
+			t.Errorf("[test %d] expected error %v, got %v\n", i, test.expectedErr, err)
+		} else if !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("[test %d] expected %q, got %q\n", i, test.expected, args)
+		}
+	}
+}
+
+func TestRemoteScript(t *testing.T) {
+	var tests = []struct {
+		cmd      interface{}
+		expected string
+	}{
+		{"npm start && echo done", `'/bin/sh' '-c' 'npm start && echo done'`},
+		{[]interface{}{"echo", "it's $HOME"}, `'echo' 'it'\''s $HOME'`},
+	}
+
+	for i, test := range tests {
+		script, err := remoteScript(test.cmd)
+		if err != nil {
+			t.Errorf("[test %d] unexpected error: %s\n", i, err)
+		} else if script != test.expected {
+			t.Errorf("[test %d] expected %s, got %s\n", i, test.expected, script)
+		}
+	}
+}
@@ -0,0 +1,580 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	gcontext "github.com/ttacon/glorious/context"
+	gerrors "github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/status"
+)
+
+func init() {
+	Register("docker/local", &dockerDriver{})
+	Register("docker/remote", &dockerDriver{remote: true})
+}
+
+type dockerDriver struct {
+	remote bool
+}
+
+func (p *Provider) dockerClient() (*client.Client, error) {
+	options := []client.Opt{
+		client.FromEnv,
+		client.WithAPIVersionNegotiation(),
+	}
+	if p.Type == "docker/remote" {
+		options = append(options, client.WithHost(p.Remote.Host))
+	}
+	return client.NewClientWithOpts(options...)
+}
+
+func (d *dockerDriver) Start(p *Provider, u Unit) error {
+	image := p.Image
+	if len(image) == 0 {
+		return errors.New("no image provided")
+	}
+
+	ctx := context.Background()
+	cli, err := p.dockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	lgr := u.GetContext().Logger()
+
+	config, hostConfig, networkingConfig, hash, err := p.containerSpec(u)
+	if err != nil {
+		lgr.Debug("failed to build container config: ", err)
+		return err
+	}
+
+	existing, err := p.findContainer(ctx, cli, u)
+	if err != nil {
+		return err
+	} else if existing != nil && !u.ForceRecreate() && upToDate(existing, hash) {
+		lgr.Info("adopting running container ", existing.ID)
+		u.SetRunningStatus(status.NewRunningStatus(nil, nil), nil)
+		return nil
+	}
+
+	// first see if the image exists
+	_, _, err = cli.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			image = p.getImageString(u, image)
+			lgr.Infof("image %q not found locally, trying to pull...", image)
+
+			if err := p.pullImage(ctx, cli, u, image); err != nil {
+				return err
+			}
+		} else {
+			lgr.Debug("failed to check for image: ", err)
+			return err
+		}
+	}
+
+	// The network mustn't be removed by a unit that's stopping until our
+	// container is running on it.
+	networkMux.Lock()
+	defer networkMux.Unlock()
+
+	if existing != nil {
+		lgr.Info("replacing out of date container ", existing.ID)
+		if err := p.removeContainer(ctx, cli, existing.ID); err != nil {
+			lgr.Debug("failed to remove container, err: ", err)
+			return err
+		}
+	}
+
+	if networkingConfig != nil {
+		lgr.Debug("connecting container to network: ", p.projectNetwork())
+		if err := p.ensureNetwork(ctx, cli); err != nil {
+			lgr.Debug("failed to create network, err: ", err)
+			return err
+		}
+	}
+
+	// The hash is of the configured image, rather than whichever tag of
+	// it we've found.
+	config.Image = image
+	config.Labels = p.containerLabels(u, hash)
+
+	name := p.containerName(u)
+	lgr.Debugf("creating container %q for image: %s\n", name, image)
+	resp, err := cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, name)
+	if err != nil {
+		lgr.Debugf("failed to create container for image %q, err %s\n", image, err)
+		return err
+	}
+
+	lgr.Debug("starting container for image: ", image)
+	if err := cli.ContainerStart(
+		ctx,
+		resp.ID,
+		types.ContainerStartOptions{},
+	); err != nil {
+		lgr.Debugf("failed to start container for image %q, err %s\n", image, err)
+		return err
+	}
+
+	u.SetRunningStatus(status.NewRunningStatus(nil, nil), nil)
+
+	lgr.Info("begun as container ", resp.ID)
+
+	return nil
+}
+
+// pullImage pulls image from its registry.
+func (p *Provider) pullImage(ctx context.Context, cli client.ImageAPIClient, u Unit, image string) error {
+	lgr := u.GetContext().Logger()
+
+	stream, pullErr := cli.ImagePull(
+		ctx,
+		image,
+		p.dockerImagePullOptions(u),
+	)
+	if pullErr != nil {
+		isUnauthorized := errdefs.IsUnauthorized(pullErr) ||
+			strings.Contains(pullErr.Error(), "no basic auth credentials")
+		lgr.Debug("pull failure was due to lack of authorization: ", isUnauthorized)
+		lgr.Debug("failed to pull image: ", image)
+		return pullErr
+	}
+	defer stream.Close()
+
+	// The image has only been pulled once the stream has been read to the
+	// end, which is also where any errors from the registry are.
+	if err := readPullProgress(stream, image, u.ReportProgress); err != nil {
+		lgr.Debugf("failed to pull image %q, err: %s\n", image, err)
+		return err
+	}
+	return nil
+}
+
+var (
+	ecrImageRegex = regexp.MustCompile("^([a-zA-Z0-9][a-zA-Z0-9-_]*).dkr.ecr.([a-zA-Z0-9][a-zA-Z0-9-_]*).amazonaws.com(.cn)?\\/.*")
+)
+
+func (p *Provider) getImageString(u Unit, image string) string {
+	lgr := u.GetContext().Logger()
+
+	lgr.Debug("identifying image string")
+	if strings.Index(image, ":") > 0 {
+		lgr.Debug("image string contains tag, no more work to do")
+		return image
+	}
+
+	pieces := strings.SplitN(image, "/", 2)
+	if len(pieces) != 2 {
+		lgr.Debug("image in unexpected format: ", image)
+		return image
+	}
+
+	registry := pieces[0]
+	registryID := strings.SplitN(registry, ".", 2)[0]
+	repository := pieces[1]
+
+	// We only support tag identification functionality for AWS ECR,
+	// currently.
+	if !ecrImageRegex.MatchString(image) {
+		lgr.Debug("image is not in an AWS ECR registry, no more work to do")
+		return image
+	}
+
+	lgr.Debug("generating AWS ECR session")
+	sesh, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		lgr.Debug("failed to generate AWS session: ", err)
+		return image
+	}
+	svc := ecr.New(sesh)
+
+	// Use DescribeImages
+	//
+	// https://docs.aws.amazon.com/sdk-for-go/api/service/ecr/#DescribeImagesInput
+	//
+	// need the repository name and (optional, registry ID (i.e. AWS account ID))
+	var mostRecentTag string
+	if err := svc.DescribeImagesPages(&ecr.DescribeImagesInput{
+		RegistryId:     aws.String(registryID),
+		RepositoryName: aws.String(repository),
+	}, func(page *ecr.DescribeImagesOutput, lastPage bool) bool {
+		images := page.ImageDetails
+
+		// TODO(ttacon): identify a better way to pull tags here
+		//
+		// One concern is if this is a named tag, we should look for an
+		// image's unique (hash) tag.
+		mostRecentTag = *(images[len(images)-1].ImageTags[0])
+		return !lastPage
+	}); err != nil {
+		lgr.Debug("failed to search all image tags, err: ", err)
+		return image
+	}
+
+	if len(mostRecentTag) == 0 {
+		lgr.Debug("failed to identify tag, exiting")
+		return image
+	}
+
+	lgr.Debug("identified tag as most recent: ", mostRecentTag)
+
+	// these our returned in order from oldest to newest, so we'll have to page through
+	// all of them...
+	//
+	// if the library supported better querying, we could do:
+	// https://stackoverflow.com/a/49413539/11254876
+
+	return image + ":" + mostRecentTag
+}
+
+func (p *Provider) dockerImagePullOptions(u Unit) types.ImagePullOptions {
+	var (
+		authFunc func(gcontext.Logger, string) types.RequestPrivilegeFunc
+		opts     types.ImagePullOptions
+
+		lgr = u.GetContext().Logger()
+	)
+	lgr.Debug("generating docker ImagePullOptions")
+
+	if p.Auth != nil {
+		lgr.Debug("using credentials from auth block")
+		token, err := p.Auth.registryAuth(p.Image)
+		if err != nil {
+			lgr.Warn("failed to use auth block, err: ", err)
+			return opts
+		}
+		return types.ImagePullOptions{RegistryAuth: token}
+	}
+
+	if funcType, ok := p.Extra["authProvider"]; !ok {
+		lgr.Debug("no authProvider identifier, using docker's credentials")
+		token, err := dockerConfigRegistryAuth(p.Image)
+		if err != nil {
+			lgr.Debug("failed to get credentials from docker's config, err: ", err)
+			return opts
+		}
+		return types.ImagePullOptions{RegistryAuth: token}
+	} else if funcType == "aws/ecr" {
+		lgr.Debug("identified authProvider of aws/ecr")
+		authFunc = awsAuthFunc
+	} else {
+		lgr.Debugf("unknown auth function %q, exiting\n", funcType)
+		return opts
+	}
+
+	image := p.Image
+	lgr.Debugf("attempting to pull image %q with PrivilegeFunc\n", image)
+	token, err := authFunc(lgr, image)()
+	if err != nil {
+		lgr.Debug("failed to generate auth information, err: ", err)
+		return opts
+	}
+
+	return types.ImagePullOptions{
+		RegistryAuth:  token,
+		PrivilegeFunc: authFunc(lgr, image),
+	}
+}
+
+func awsAuthFunc(lgr gcontext.Logger, image string) types.RequestPrivilegeFunc {
+	// Separate out register, repository and tag info
+	//
+	// 351073081746.dkr.ecr.us-east-1.amazonaws.com/mixmax-apps/files:53226da5
+
+	var registry string
+	if pieces := strings.SplitN(image, "/", 2); len(pieces) == 2 {
+		registry = pieces[0]
+	}
+
+	return func() (string, error) {
+		lgr.Debug("generating AWS SDK client")
+		sesh, err := session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			lgr.Debug("failed to generate AWS session: ", err)
+			return "", err
+		}
+		svc := ecr.New(sesh)
+
+		// TODO(ttacon): support specifying the registry.
+		// https://docs.aws.amazon.com/sdk-for-go/api/service/ecr/#GetAuthorizationTokenInput
+		// https://docs.aws.amazon.com/sdk-for-go/api/service/ecr/#ECR.GetAuthorizationToken
+		lgr.Debug("requesting ECR authentication token")
+		authTokenInput := ecr.GetAuthorizationTokenInput{}
+		if len(registry) > 0 {
+			authTokenInput.RegistryIds = []*string{
+				aws.String(strings.Split(registry, ".")[0]),
+			}
+		}
+		result, err := svc.GetAuthorizationToken(&authTokenInput)
+		if err != nil {
+			lgr.Debug("failed to retrieve authorization token: ", err)
+			return "", err
+		} else if len(result.AuthorizationData) == 0 {
+			lgr.Debug("ECR authorization response had no authorization data")
+			return "", errors.New("no valid authorization returned")
+		}
+
+		lgr.Debug("ECR returned authorization data (num): ", len(result.AuthorizationData))
+		token := *result.AuthorizationData[0].AuthorizationToken
+		decodedToken, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return "", err
+		}
+
+		parts := strings.Split(string(decodedToken), ":")
+
+		rawJSON, _ := json.Marshal(map[string]string{
+			"username": parts[0],
+			"password": parts[1],
+		})
+		return base64.StdEncoding.EncodeToString(rawJSON), nil
+	}
+}
+
+func (d *dockerDriver) Stop(p *Provider, u Unit) error {
+	ctx := context.Background()
+	cli, err := p.dockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	c, err := p.findContainer(ctx, cli, u)
+	if err != nil {
+		return err
+	} else if c != nil {
+		if err := p.removeContainer(ctx, cli, c.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := p.removeNetworkIfUnused(ctx, cli); err != nil {
+		u.GetContext().Logger().Debug("failed to remove network, err: ", err)
+	}
+
+	stat := u.GetStatus()
+
+	stat.Stop()
+
+	return nil
+}
+
+// IsStale returns whether the unit's container was created from a different
+// config to the one it has now.
+func (d *dockerDriver) IsStale(p *Provider, u Unit) (bool, error) {
+	ctx := context.Background()
+	cli, err := p.dockerClient()
+	if err != nil {
+		return false, err
+	}
+	defer cli.Close()
+
+	_, _, _, hash, err := p.containerSpec(u)
+	if err != nil {
+		return false, err
+	}
+
+	c, err := p.findContainer(ctx, cli, u)
+	if err != nil || c == nil {
+		return false, err
+	}
+	return !upToDate(c, hash), nil
+}
+
+// removeContainer stops the container, giving it the stop grace period to
+// exit, and then removes it.
+func (p *Provider) removeContainer(ctx context.Context, cli client.ContainerAPIClient, id string) error {
+	// Without a grace period, the container's own stop timeout is used.
+	var timeout *time.Duration
+	if len(p.StopGracePeriod) > 0 {
+		grace, err := p.stopGracePeriod()
+		if err != nil {
+			return err
+		}
+		timeout = &grace
+	}
+
+	if err := cli.ContainerStop(ctx, id, timeout); err != nil {
+		return err
+	}
+	return cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{})
+}
+
+func (d *dockerDriver) Status(p *Provider, u Unit) (*status.Status, error) {
+	ctx := context.Background()
+	cli, err := p.dockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	if c, err := p.findContainer(ctx, cli, u); err != nil || c == nil || c.State != "running" {
+		return nil, err
+	}
+
+	if stat := u.GetStatus(); stat != nil && stat.IsRunning() {
+		return stat, nil
+	}
+	return status.NewRunningStatus(nil, nil), nil
+}
+
+func (d *dockerDriver) Logs(
+	p *Provider,
+	u Unit,
+	opts LogOptions,
+	dataChan chan []byte,
+) (func(), error) {
+	cli, err := p.dockerClient()
+	if err != nil {
+		return nil, err
+	}
+	return p.containerLogs(cli, u, opts, dataChan)
+}
+
+// maxLogLineSize is the longest line of a container's output that we'll
+// read, rather than give up on the rest of it.
+const maxLogLineSize = 1024 * 1024
+
+// containerLogs sends the output of the unit's container to dataChan, see
+// Driver.Logs. The client is closed once we're done with it.
+func (p *Provider) containerLogs(
+	cli client.CommonAPIClient,
+	u Unit,
+	opts LogOptions,
+	dataChan chan []byte,
+) (func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c, err := p.findContainer(ctx, cli, u)
+	if err == nil && c == nil {
+		err = fmt.Errorf("no container found for unit %q", u.GetName())
+	}
+	if err != nil {
+		cancel()
+		cli.Close()
+		return nil, err
+	}
+
+	info, err := cli.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		cancel()
+		cli.Close()
+		return nil, err
+	}
+
+	logOpts := types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Since:      opts.Since,
+	}
+	if opts.Lines > 0 {
+		logOpts.Tail = strconv.Itoa(opts.Lines)
+	}
+
+	logs, err := cli.ContainerLogs(ctx, c.ID, logOpts)
+	if err != nil {
+		cancel()
+		cli.Close()
+		return nil, err
+	}
+
+	// Containers without a TTY multiplex stdout and stderr onto the
+	// same stream, so split them back out.
+	var readers []io.ReadCloser
+	if info.Config != nil && info.Config.Tty {
+		readers = []io.ReadCloser{logs}
+	} else {
+		stdoutR, stdoutW := io.Pipe()
+		stderrR, stderrW := io.Pipe()
+		go func() {
+			_, err := stdcopy.StdCopy(stdoutW, stderrW, logs)
+			stdoutW.CloseWithError(err)
+			stderrW.CloseWithError(err)
+		}()
+		readers = []io.ReadCloser{stdoutR, stderrR}
+	}
+
+	lgr := u.GetContext().Logger()
+
+	var wg sync.WaitGroup
+	for _, r := range readers {
+		wg.Add(1)
+		go func(r io.ReadCloser) {
+			defer wg.Done()
+
+			scanner := bufio.NewScanner(r)
+			scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+			for scanner.Scan() {
+				dataChan <- []byte(scanner.Text())
+			}
+
+			// Don't leave the demuxing blocked on us if we gave up
+			// early.
+			_ = r.Close()
+
+			// Errors from being stopped, or from the other stream
+			// giving up, aren't worth mentioning.
+			if err := scanner.Err(); err != nil && err != io.ErrClosedPipe && ctx.Err() == nil {
+				lgr.Errorf("[unit:%q] failed to read logs: %s\n", u.GetName(), err)
+			}
+		}(r)
+	}
+
+	go func() {
+		wg.Wait()
+		cli.Close()
+		close(dataChan)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			_ = logs.Close()
+		})
+	}, nil
+}
+
+func (d *dockerDriver) Validate(p *Provider) []error {
+	var errs []error
+	if d.remote {
+		if len(p.Remote.Host) == 0 {
+			errs = append(errs, gerrors.ErrDockerRemoteMissingRemote)
+		}
+	}
+	if len(p.Image) == 0 {
+		errs = append(errs, gerrors.ErrDockerMissingImage)
+	}
+	if len(p.Handlers) > 0 {
+		errs = append(errs, gerrors.ErrDockerExtraneousFields)
+	}
+	errs = append(errs, p.validateStop()...)
+	errs = append(errs, p.validateEnvironment()...)
+	errs = append(errs, p.validateContainer()...)
+	return errs
+}
@@ -0,0 +1,240 @@
+package provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// dockerHubServerAddress is the address that docker hub's credentials are
+// kept under.
+const dockerHubServerAddress = "https://index.docker.io/v1/"
+
+// credentialsNotFound is what credential helpers output for registries they
+// have no credentials for.
+const credentialsNotFound = "credentials not found in native keychain"
+
+var (
+	errCredentialsNotFound = errors.New(credentialsNotFound)
+
+	// findCredentialHelper returns the path of the binary for the named
+	// docker credential helper.
+	findCredentialHelper = func(name string) (string, error) {
+		return exec.LookPath("docker-credential-" + name)
+	}
+)
+
+// dockerConfigFile is the part of docker's config.json that has registry
+// credentials.
+type dockerConfigFile struct {
+	Auths       map[string]dockerConfigAuth `json:"auths"`
+	CredsStore  string                      `json:"credsStore"`
+	CredHelpers map[string]string           `json:"credHelpers"`
+}
+
+type dockerConfigAuth struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+	RegistryToken string `json:"registrytoken"`
+}
+
+// registryAuth returns the encoded credentials to pull image with.
+func (a *RegistryAuth) registryAuth(image string) (string, error) {
+	password, ok := os.LookupEnv(a.PasswordEnv)
+	if !ok {
+		return "", fmt.Errorf("password_env %s is not set", a.PasswordEnv)
+	}
+
+	return encodeRegistryAuth(types.AuthConfig{
+		Username:      a.Username,
+		Password:      password,
+		ServerAddress: registryServerAddress(image),
+	})
+}
+
+func (a *RegistryAuth) validate() error {
+	if a == nil {
+		return nil
+	} else if len(a.Username) == 0 || len(a.PasswordEnv) == 0 {
+		return errors.New("auth must have a username and password_env")
+	}
+	return nil
+}
+
+// dockerConfigRegistryAuth returns the encoded credentials that docker has
+// for image's registry, or nothing if it has none.
+func dockerConfigRegistryAuth(image string) (string, error) {
+	config, err := loadDockerConfig()
+	if err != nil {
+		return "", err
+	}
+
+	auth, err := config.authConfig(registryServerAddress(image))
+	if err != nil {
+		return "", err
+	} else if auth == (types.AuthConfig{}) {
+		return "", nil
+	}
+	return encodeRegistryAuth(auth)
+}
+
+// loadDockerConfig reads docker's config.json, which is in $DOCKER_CONFIG or
+// else ~/.docker, as it is for the docker CLI.
+func loadDockerConfig() (*dockerConfigFile, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if len(dir) == 0 {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(homeDir, ".docker")
+	}
+
+	config := &dockerConfigFile{}
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("invalid docker config: %s", err)
+	}
+	return config, nil
+}
+
+// authConfig returns the credentials for the registry at serverAddress. As
+// with the docker CLI, a credential helper for the registry is used first,
+// then the credentials store, and then any credentials in auths.
+func (c *dockerConfigFile) authConfig(serverAddress string) (types.AuthConfig, error) {
+	helper := c.CredHelpers[serverAddress]
+	if len(helper) == 0 {
+		helper = c.CredsStore
+	}
+	if len(helper) > 0 {
+		auth, err := credentialHelperAuth(helper, serverAddress)
+		if err != errCredentialsNotFound {
+			return auth, err
+		}
+	}
+
+	entry, ok := c.Auths[serverAddress]
+	if !ok {
+		// Registries may be keyed with a scheme or path, which we
+		// don't care for.
+		for key, e := range c.Auths {
+			if registryHostname(key) == registryHostname(serverAddress) {
+				entry, ok = e, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return types.AuthConfig{}, nil
+	}
+
+	auth := types.AuthConfig{
+		Username:      entry.Username,
+		Password:      entry.Password,
+		ServerAddress: serverAddress,
+		IdentityToken: entry.IdentityToken,
+		RegistryToken: entry.RegistryToken,
+	}
+	if len(entry.Auth) > 0 {
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return types.AuthConfig{}, fmt.Errorf("invalid auth for %s: %s", serverAddress, err)
+		}
+		pieces := strings.SplitN(string(decoded), ":", 2)
+		if len(pieces) != 2 {
+			return types.AuthConfig{}, fmt.Errorf("invalid auth for %s", serverAddress)
+		}
+		auth.Username, auth.Password = pieces[0], pieces[1]
+	}
+	return auth, nil
+}
+
+// credentialHelperAuth asks the docker-credential-<helper> binary for the
+// credentials for serverAddress.
+func credentialHelperAuth(helper, serverAddress string) (types.AuthConfig, error) {
+	path, err := findCredentialHelper(helper)
+	if err != nil {
+		return types.AuthConfig{}, err
+	}
+
+	cmd := exec.Command(path, "get")
+	cmd.Stdin = strings.NewReader(serverAddress)
+	out, err := cmd.Output()
+	if err != nil {
+		// Helpers write their errors to stdout.
+		msg := strings.TrimSpace(string(out))
+		if msg == credentialsNotFound {
+			return types.AuthConfig{}, errCredentialsNotFound
+		} else if len(msg) == 0 {
+			msg = err.Error()
+		}
+		return types.AuthConfig{}, fmt.Errorf("docker-credential-%s: %s", helper, msg)
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return types.AuthConfig{}, fmt.Errorf("docker-credential-%s: %s", helper, err)
+	}
+
+	auth := types.AuthConfig{ServerAddress: serverAddress}
+	if creds.Username == "<token>" {
+		auth.IdentityToken = creds.Secret
+	} else {
+		auth.Username, auth.Password = creds.Username, creds.Secret
+	}
+	return auth, nil
+}
+
+// registryServerAddress returns the address that credentials for image's
+// registry are kept under. Images without a registry are from docker hub.
+func registryServerAddress(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return dockerHubServerAddress
+	}
+
+	domain := image[:i]
+	if !strings.ContainsAny(domain, ".:") && domain != "localhost" {
+		return dockerHubServerAddress
+	}
+	switch domain {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return dockerHubServerAddress
+	}
+	return domain
+}
+
+// registryHostname returns the hostname of a registry that's given as a URL.
+func registryHostname(address string) string {
+	address = strings.TrimPrefix(address, "https://")
+	address = strings.TrimPrefix(address, "http://")
+	return strings.SplitN(address, "/", 2)[0]
+}
+
+// encodeRegistryAuth encodes credentials as the docker API expects them.
+func encodeRegistryAuth(auth types.AuthConfig) (string, error) {
+	raw, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,174 @@
+package provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+// fakeCredentialHelper is run in place of a docker-credential-* binary, see
+// TestMain.
+func fakeCredentialHelper() int {
+	if len(os.Args) < 2 || os.Args[len(os.Args)-1] != "get" {
+		fmt.Println("unknown command")
+		return 1
+	}
+
+	serverAddress, _ := ioutil.ReadAll(os.Stdin)
+	switch string(serverAddress) {
+	case "ghcr.io":
+		fmt.Println(`{"ServerURL":"ghcr.io","Username":"octocat","Secret":"ghp_secret"}`)
+	case "gcr.io":
+		fmt.Println(`{"ServerURL":"gcr.io","Username":"<token>","Secret":"refresh"}`)
+	default:
+		fmt.Println(credentialsNotFound)
+		return 1
+	}
+	return 0
+}
+
+func decodeRegistryAuth(t *testing.T, token string) types.AuthConfig {
+	var auth types.AuthConfig
+	if len(token) == 0 {
+		return auth
+	}
+
+	raw, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatal("failed to decode registry auth: ", err)
+	} else if err := json.Unmarshal(raw, &auth); err != nil {
+		t.Fatal("failed to decode registry auth: ", err)
+	}
+	return auth
+}
+
+func TestRegistryServerAddress(t *testing.T) {
+	var tests = []struct {
+		image    string
+		expected string
+	}{
+		{"redis", dockerHubServerAddress},
+		{"library/redis:5", dockerHubServerAddress},
+		{"docker.io/library/redis:5", dockerHubServerAddress},
+		{"ghcr.io/org/app:1.0", "ghcr.io"},
+		{"localhost/app", "localhost"},
+		{"registry.local:5000/app@sha256:abc", "registry.local:5000"},
+	}
+
+	for i, test := range tests {
+		if got := registryServerAddress(test.image); got != test.expected {
+			t.Errorf("[test %d] expected %q, got %q\n", i, test.expected, got)
+		}
+	}
+}
+
+func TestDockerConfigRegistryAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := `{
+		"auths": {
+			"https://index.docker.io/v1/": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("hub:hunter2")) + `"},
+			"https://registry.example.com/v2/": {"username": "me", "password": "pw"}
+		},
+		"credsStore": "fake",
+		"credHelpers": {
+			"gcr.io": "fake",
+			"broken.example.com": "missing"
+		}
+	}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	oldDockerConfig := os.Getenv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Setenv("DOCKER_CONFIG", oldDockerConfig)
+
+	os.Setenv("GLORIOUS_TEST_CREDENTIAL_HELPER", "1")
+	defer os.Unsetenv("GLORIOUS_TEST_CREDENTIAL_HELPER")
+
+	oldFindCredentialHelper := findCredentialHelper
+	findCredentialHelper = func(name string) (string, error) {
+		if name != "fake" {
+			return "", errors.New("not found")
+		}
+		return os.Args[0], nil
+	}
+	defer func() {
+		findCredentialHelper = oldFindCredentialHelper
+	}()
+
+	var tests = []struct {
+		image    string
+		expected types.AuthConfig
+		hasErr   bool
+	}{
+		// Not in the credentials store, so from auths.
+		{"redis:5", types.AuthConfig{
+			Username:      "hub",
+			Password:      "hunter2",
+			ServerAddress: dockerHubServerAddress,
+		}, false},
+		{"registry.example.com/app", types.AuthConfig{
+			Username:      "me",
+			Password:      "pw",
+			ServerAddress: "registry.example.com",
+		}, false},
+
+		// From the credentials store.
+		{"ghcr.io/org/app", types.AuthConfig{
+			Username:      "octocat",
+			Password:      "ghp_secret",
+			ServerAddress: "ghcr.io",
+		}, false},
+
+		// From the registry's credential helper.
+		{"gcr.io/project/app", types.AuthConfig{
+			IdentityToken: "refresh",
+			ServerAddress: "gcr.io",
+		}, false},
+
+		{"quay.io/org/app", types.AuthConfig{}, false},
+		{"broken.example.com/app", types.AuthConfig{}, true},
+	}
+
+	for i, test := range tests {
+		token, err := dockerConfigRegistryAuth(test.image)
+		if (err != nil) != test.hasErr {
+			t.Errorf("[test %d] expected error %t, got %v\n", i, test.hasErr, err)
+		} else if got := decodeRegistryAuth(t, token); got != test.expected {
+			t.Errorf("[test %d] expected %+v, got %+v\n", i, test.expected, got)
+		}
+	}
+}
+
+func TestRegistryAuthBlock(t *testing.T) {
+	auth := &RegistryAuth{Username: "me", PasswordEnv: "GLORIOUS_TEST_REGISTRY_PASSWORD"}
+	if _, err := auth.registryAuth("ghcr.io/org/app"); err == nil {
+		t.Error("expected an error while the password isn't set")
+	}
+
+	os.Setenv("GLORIOUS_TEST_REGISTRY_PASSWORD", "s3cret")
+	defer os.Unsetenv("GLORIOUS_TEST_REGISTRY_PASSWORD")
+
+	token, err := auth.registryAuth("ghcr.io/org/app")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+
+	expected := types.AuthConfig{Username: "me", Password: "s3cret", ServerAddress: "ghcr.io"}
+	if got := decodeRegistryAuth(t, token); got != expected {
+		t.Errorf("expected %+v, got %+v\n", expected, got)
+	}
+}
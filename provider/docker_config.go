@@ -0,0 +1,372 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	gerrors "github.com/ttacon/glorious/errors"
+)
+
+// containerConfig returns the configs to create the provider's container
+// from image with.
+func (p *Provider) containerConfig(image string) (*container.Config, *container.HostConfig, error) {
+	env, err := p.environment(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := &container.Config{
+		Image:      image,
+		Env:        env,
+		User:       p.User,
+		WorkingDir: p.WorkingDir,
+		Labels:     p.Labels,
+	}
+	if config.Cmd, err = dockerCommand("cmd", p.Cmd); err != nil {
+		return nil, nil, err
+	}
+	if config.Entrypoint, err = dockerCommand("entrypoint", p.Entrypoint); err != nil {
+		return nil, nil, err
+	}
+	if config.Healthcheck, err = p.Healthcheck.healthConfig(); err != nil {
+		return nil, nil, err
+	}
+	if len(p.StopSignal) > 0 {
+		config.StopSignal = "SIG" + p.stopSignalName()
+	}
+
+	hostConfig := &container.HostConfig{
+		NetworkMode: container.NetworkMode(p.NetworkMode),
+		ExtraHosts:  p.ExtraHosts,
+	}
+	if hostConfig.PortBindings, err = p.portBindings(); err != nil {
+		return nil, nil, err
+	}
+	if hostConfig.Mounts, err = p.mounts(); err != nil {
+		return nil, nil, err
+	}
+	if hostConfig.Tmpfs, err = p.tmpfs(); err != nil {
+		return nil, nil, err
+	}
+	if hostConfig.Resources, err = p.resources(); err != nil {
+		return nil, nil, err
+	}
+	if hostConfig.RestartPolicy, err = p.restartPolicy(); err != nil {
+		return nil, nil, err
+	}
+	return config, hostConfig, nil
+}
+
+// containerSpec returns everything that the unit's container is created
+// with, along with the hash of it that's kept in the container's labels.
+func (p *Provider) containerSpec(u Unit) (
+	*container.Config,
+	*container.HostConfig,
+	*network.NetworkingConfig,
+	string,
+	error,
+) {
+	config, hostConfig, err := p.containerConfig(p.Image)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+
+	networkingConfig := p.networkingConfig(u.GetName())
+	if networkingConfig != nil {
+		hostConfig.NetworkMode = container.NetworkMode(p.projectNetwork())
+	}
+
+	hash, err := configHash(config, hostConfig, networkingConfig)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+	return config, hostConfig, networkingConfig, hash, nil
+}
+
+// dockerCommand returns cmd, in either the exec or shell form, as the
+// arguments for a container's command or entrypoint.
+func dockerCommand(name string, cmd interface{}) ([]string, error) {
+	if cmd == nil {
+		return nil, nil
+	}
+
+	args, err := command(cmd, remoteShell)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a non-empty string or list of strings", name)
+	}
+	return args, nil
+}
+
+func (p *Provider) portBindings() (nat.PortMap, error) {
+	if len(p.Ports) == 0 {
+		return nil, nil
+	}
+
+	bindings := nat.PortMap{}
+	for _, port := range p.Ports {
+		vals, err := nat.ParsePortSpec(port)
+		if err != nil {
+			return nil, err
+		}
+		for _, val := range vals {
+			bindings[val.Port] = append(bindings[val.Port], val.Binding)
+		}
+	}
+	return bindings, nil
+}
+
+// mounts returns the provider's volumes, which are given as
+// [source:]target[:ro|rw]. Sources that are paths are bind mounted, and any
+// others are the names of docker volumes. Volumes without a source are
+// anonymous.
+func (p *Provider) mounts() ([]mount.Mount, error) {
+	if len(p.Volumes) == 0 {
+		return nil, nil
+	}
+
+	mounts := make([]mount.Mount, len(p.Volumes))
+	for i, volume := range p.Volumes {
+		pieces := strings.Split(volume, ":")
+		if len(pieces) > 3 {
+			return nil, fmt.Errorf("invalid volume %q", volume)
+		}
+
+		m := mount.Mount{Type: mount.TypeVolume, Target: pieces[0]}
+		if len(pieces) > 1 {
+			m.Source, m.Target = pieces[0], pieces[1]
+			if isBindSource(m.Source) {
+				m.Type = mount.TypeBind
+			}
+		}
+		if len(pieces) == 3 {
+			switch pieces[2] {
+			case "ro":
+				m.ReadOnly = true
+			case "rw":
+			default:
+				return nil, fmt.Errorf("invalid volume %q, mode must be ro or rw", volume)
+			}
+		}
+
+		if !path.IsAbs(m.Target) {
+			return nil, fmt.Errorf("invalid volume %q, target must be an absolute path", volume)
+		}
+		mounts[i] = m
+	}
+	return mounts, nil
+}
+
+// isBindSource returns whether a volume's source is a path on the docker
+// host, rather than the name of a docker volume.
+func isBindSource(source string) bool {
+	return filepath.IsAbs(source) || strings.HasPrefix(source, "/") ||
+		strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~") ||
+		strings.HasPrefix(source, "$")
+}
+
+// tmpfs returns the provider's tmpfs mounts, which are given as a path and
+// optionally the mount options (i.e. /run:size=64m).
+func (p *Provider) tmpfs() (map[string]string, error) {
+	if len(p.Tmpfs) == 0 {
+		return nil, nil
+	}
+
+	tmpfs := make(map[string]string)
+	for _, t := range p.Tmpfs {
+		pieces := strings.SplitN(t, ":", 2)
+		if !path.IsAbs(pieces[0]) {
+			return nil, fmt.Errorf("invalid tmpfs %q, must be an absolute path", t)
+		}
+		if len(pieces) == 2 {
+			tmpfs[pieces[0]] = pieces[1]
+		} else {
+			tmpfs[pieces[0]] = ""
+		}
+	}
+	return tmpfs, nil
+}
+
+func (p *Provider) resources() (container.Resources, error) {
+	var resources container.Resources
+	if len(p.Memory) > 0 {
+		memory, err := units.RAMInBytes(p.Memory)
+		if err != nil {
+			return resources, fmt.Errorf("invalid memory: %s", err)
+		}
+		resources.Memory = memory
+	}
+
+	if p.CPUs < 0 {
+		return resources, errors.New("cpus cannot be negative")
+	}
+	resources.NanoCPUs = int64(p.CPUs * 1e9)
+	return resources, nil
+}
+
+// restartPolicy returns the provider's restart_policy, one of no, always,
+// unless-stopped or on-failure[:max-retries].
+func (p *Provider) restartPolicy() (container.RestartPolicy, error) {
+	var (
+		policy  container.RestartPolicy
+		retries string
+	)
+	policy.Name = p.RestartPolicy
+	if i := strings.Index(policy.Name, ":"); i >= 0 {
+		policy.Name, retries = policy.Name[:i], policy.Name[i+1:]
+	}
+
+	switch policy.Name {
+	case "", "no", "always", "unless-stopped":
+		if len(retries) == 0 {
+			return policy, nil
+		}
+	case "on-failure":
+		if len(retries) == 0 {
+			return policy, nil
+		}
+		n, err := strconv.Atoi(retries)
+		if err == nil && n >= 0 {
+			policy.MaximumRetryCount = n
+			return policy, nil
+		}
+	}
+	return policy, fmt.Errorf(
+		"invalid restart_policy %q, must be one of no, always, unless-stopped or on-failure[:max-retries]",
+		p.RestartPolicy,
+	)
+}
+
+func (h *DockerHealthcheck) healthConfig() (*container.HealthConfig, error) {
+	if h == nil {
+		return nil, nil
+	} else if h.Disable {
+		return &container.HealthConfig{Test: []string{"NONE"}}, nil
+	}
+
+	var test []string
+	if script, ok := h.Test.(string); ok {
+		if len(strings.TrimSpace(script)) == 0 {
+			return nil, errors.New("healthcheck test cannot be empty")
+		}
+		test = []string{"CMD-SHELL", script}
+	} else {
+		args, err := command(h.Test, nil)
+		if err != nil {
+			return nil, errors.New("healthcheck test must be a non-empty string or list of strings")
+		}
+		switch args[0] {
+		case "CMD", "CMD-SHELL", "NONE":
+			test = args
+		default:
+			test = append([]string{"CMD"}, args...)
+		}
+	}
+
+	config := &container.HealthConfig{Test: test, Retries: h.Retries}
+	for _, d := range []struct {
+		name  string
+		raw   string
+		value *time.Duration
+	}{
+		{"interval", h.Interval, &config.Interval},
+		{"timeout", h.Timeout, &config.Timeout},
+		{"start_period", h.StartPeriod, &config.StartPeriod},
+	} {
+		if len(d.raw) == 0 {
+			continue
+		}
+		duration, err := time.ParseDuration(d.raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck %s: %s", d.name, err)
+		} else if duration < 0 {
+			return nil, fmt.Errorf("healthcheck %s cannot be negative", d.name)
+		}
+		*d.value = duration
+	}
+
+	if h.Retries < 0 {
+		return nil, errors.New("healthcheck retries cannot be negative")
+	}
+	return config, nil
+}
+
+// validateExtraHosts checks that extra_hosts are all host:ip.
+func (p *Provider) validateExtraHosts() error {
+	for _, host := range p.ExtraHosts {
+		pieces := strings.SplitN(host, ":", 2)
+		if len(pieces) != 2 || len(pieces[0]) == 0 ||
+			(net.ParseIP(pieces[1]) == nil && pieces[1] != "host-gateway") {
+			return fmt.Errorf("invalid extra_hosts entry %q, must be host:ip", host)
+		}
+	}
+	return nil
+}
+
+// validateContainer checks the provider's docker container config.
+func (p *Provider) validateContainer() []error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, gerrors.ProviderErr{
+				ProviderType: p.Type,
+				Err:          err,
+			})
+		}
+	}
+
+	_, err := dockerCommand("cmd", p.Cmd)
+	check(err)
+	_, err = dockerCommand("entrypoint", p.Entrypoint)
+	check(err)
+	if len(p.WorkingDir) > 0 && !path.IsAbs(p.WorkingDir) {
+		check(errors.New("workingDir must be an absolute path in the container"))
+	}
+	_, err = p.Healthcheck.healthConfig()
+	check(err)
+	_, err = p.portBindings()
+	check(err)
+	_, err = p.mounts()
+	check(err)
+	_, err = p.tmpfs()
+	check(err)
+	_, err = p.resources()
+	check(err)
+	_, err = p.restartPolicy()
+	check(err)
+	check(p.validateExtraHosts())
+	check(p.validateUpdatePolicy())
+	check(p.Auth.validate())
+	return errs
+}
+
+// hasContainerFields returns whether any of the fields that only docker
+// providers support are set.
+func (p *Provider) hasContainerFields() bool {
+	return len(p.Image) > 0 ||
+		len(p.Ports) > 0 ||
+		len(p.Volumes) > 0 ||
+		p.Entrypoint != nil ||
+		len(p.User) > 0 ||
+		len(p.Labels) > 0 ||
+		len(p.Tmpfs) > 0 ||
+		len(p.NetworkMode) > 0 ||
+		len(p.ExtraHosts) > 0 ||
+		len(p.Memory) > 0 ||
+		p.CPUs != 0 ||
+		len(p.RestartPolicy) > 0 ||
+		p.Healthcheck != nil ||
+		len(p.UpdatePolicy) > 0 ||
+		len(p.UpdateInterval) > 0 ||
+		p.Auth != nil
+}
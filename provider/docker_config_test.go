@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestProviderContainerConfig(t *testing.T) {
+	p := Provider{
+		Type:        "docker/local",
+		Image:       "mongo:4",
+		Cmd:         []interface{}{"mongod", "--replSet", "rs0"},
+		Entrypoint:  "docker-entrypoint.sh",
+		User:        "mongodb",
+		WorkingDir:  "/data",
+		Labels:      map[string]string{"team": "core"},
+		Environment: []string{"MONGO_INITDB_DATABASE=app"},
+		Ports:       []string{"27017:27017"},
+		Volumes:     []string{"/srv/mongo:/data/db", "mongo-config:/data/configdb:ro", "/tmp/cache"},
+		Tmpfs:       []string{"/run:size=64m", "/tmp"},
+		NetworkMode: "host",
+		ExtraHosts:  []string{"registry.local:10.0.0.2"},
+		Memory:      "512m",
+		CPUs:        1.5,
+		StopSignal:  "SIGINT",
+
+		RestartPolicy: "on-failure:3",
+		Healthcheck: &DockerHealthcheck{
+			Test:     []interface{}{"mongo", "--eval", "db.stats()"},
+			Interval: "10s",
+			Retries:  5,
+		},
+	}
+
+	config, hostConfig, err := p.containerConfig(p.Image)
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+
+	expectedConfig := &container.Config{
+		Image:      "mongo:4",
+		Env:        []string{"MONGO_INITDB_DATABASE=app"},
+		Cmd:        []string{"mongod", "--replSet", "rs0"},
+		Entrypoint: []string{"/bin/sh", "-c", "docker-entrypoint.sh"},
+		User:       "mongodb",
+		WorkingDir: "/data",
+		Labels:     map[string]string{"team": "core"},
+		StopSignal: "SIGINT",
+		Healthcheck: &container.HealthConfig{
+			Test:     []string{"CMD", "mongo", "--eval", "db.stats()"},
+			Interval: 10 * time.Second,
+			Retries:  5,
+		},
+	}
+	if !reflect.DeepEqual(config, expectedConfig) {
+		t.Errorf("expected config %+v, got %+v\n", expectedConfig, config)
+	}
+
+	expectedHostConfig := &container.HostConfig{
+		NetworkMode: "host",
+		ExtraHosts:  []string{"registry.local:10.0.0.2"},
+		PortBindings: nat.PortMap{
+			"27017/tcp": []nat.PortBinding{{HostPort: "27017"}},
+		},
+		Mounts: []mount.Mount{
+			{Type: mount.TypeBind, Source: "/srv/mongo", Target: "/data/db"},
+			{Type: mount.TypeVolume, Source: "mongo-config", Target: "/data/configdb", ReadOnly: true},
+			{Type: mount.TypeVolume, Target: "/tmp/cache"},
+		},
+		Tmpfs: map[string]string{"/run": "size=64m", "/tmp": ""},
+		Resources: container.Resources{
+			Memory:   512 * 1024 * 1024,
+			NanoCPUs: 1500000000,
+		},
+		RestartPolicy: container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3},
+	}
+	if !reflect.DeepEqual(hostConfig, expectedHostConfig) {
+		t.Errorf("expected host config %+v, got %+v\n", expectedHostConfig, hostConfig)
+	}
+}
+
+func TestProviderRestartPolicy(t *testing.T) {
+	var tests = []struct {
+		policy      string
+		expected    container.RestartPolicy
+		expectedErr bool
+	}{
+		{"", container.RestartPolicy{}, false},
+		{"always", container.RestartPolicy{Name: "always"}, false},
+		{"unless-stopped", container.RestartPolicy{Name: "unless-stopped"}, false},
+		{"on-failure", container.RestartPolicy{Name: "on-failure"}, false},
+		{"on-failure:5", container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 5}, false},
+		{"on-failure:-1", container.RestartPolicy{}, true},
+		{"always:5", container.RestartPolicy{}, true},
+		{"sometimes", container.RestartPolicy{}, true},
+	}
+
+	for i, test := range tests {
+		p := Provider{RestartPolicy: test.policy}
+		got, err := p.restartPolicy()
+		if test.expectedErr {
+			if err == nil {
+				t.Errorf("[test %d] expected an error for %q\n", i, test.policy)
+			}
+		} else if err != nil {
+			t.Errorf("[test %d] unexpected error: %s\n", i, err)
+		} else if got != test.expected {
+			t.Errorf("[test %d] expected %+v, got %+v\n", i, test.expected, got)
+		}
+	}
+}
+
+func TestProviderValidateContainer(t *testing.T) {
+	var tests = []struct {
+		provider     Provider
+		expectedErrs int
+	}{
+		{Provider{Type: "docker/local"}, 0},
+		{Provider{Type: "docker/local", Cmd: []interface{}{}}, 1},
+		{Provider{Type: "docker/local", Entrypoint: 3}, 1},
+		{Provider{Type: "docker/local", WorkingDir: "app"}, 1},
+		{Provider{Type: "docker/local", Volumes: []string{"data:app"}}, 1},
+		{Provider{Type: "docker/local", Volumes: []string{"./data:/data:rx"}}, 1},
+		{Provider{Type: "docker/local", Tmpfs: []string{"run"}}, 1},
+		{Provider{Type: "docker/local", Ports: []string{"80:http"}}, 1},
+		{Provider{Type: "docker/local", ExtraHosts: []string{"db"}}, 1},
+		{Provider{Type: "docker/local", ExtraHosts: []string{"db:nowhere"}}, 1},
+		{Provider{Type: "docker/local", ExtraHosts: []string{"host.docker.internal:host-gateway", "db:::1"}}, 0},
+		{Provider{Type: "docker/local", Memory: "1x"}, 1},
+		{Provider{Type: "docker/local", CPUs: -1}, 1},
+		{Provider{Type: "docker/local", Healthcheck: &DockerHealthcheck{}}, 1},
+		{Provider{Type: "docker/local", Healthcheck: &DockerHealthcheck{Disable: true}}, 0},
+		{Provider{Type: "docker/local", Healthcheck: &DockerHealthcheck{Test: "true", Timeout: "soon"}}, 1},
+		{Provider{Type: "docker/local", UpdatePolicy: "recreate", UpdateInterval: "1m"}, 0},
+		{Provider{Type: "docker/local", UpdatePolicy: "always"}, 1},
+		{Provider{Type: "docker/local", UpdatePolicy: "notify", UpdateInterval: "0s"}, 1},
+		{Provider{Type: "docker/local", Auth: &RegistryAuth{Username: "me", PasswordEnv: "REGISTRY_PASSWORD"}}, 0},
+		{Provider{Type: "docker/local", Auth: &RegistryAuth{Username: "me"}}, 1},
+	}
+
+	for i, test := range tests {
+		if errs := test.provider.validateContainer(); len(errs) != test.expectedErrs {
+			t.Errorf("[test %d] expected %d errors, got %v\n", i, test.expectedErrs, errs)
+		}
+	}
+}
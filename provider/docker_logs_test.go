@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func (f *fakeImageClient) ContainerInspect(
+	ctx context.Context,
+	id string,
+) (types.ContainerJSON, error) {
+	return types.ContainerJSON{Config: &container.Config{Tty: f.tty}}, nil
+}
+
+func (f *fakeImageClient) ContainerLogs(
+	ctx context.Context,
+	id string,
+	options types.ContainerLogsOptions,
+) (io.ReadCloser, error) {
+	return f.logs, nil
+}
+
+func (f *fakeImageClient) Close() error {
+	f.closed = true
+	return nil
+}
+
+// readLogs collects the lines sent for each of the unit's streams, telling
+// them apart by their prefix.
+func readLogs(t *testing.T, dataChan chan []byte) map[string][]string {
+	lines := make(map[string][]string)
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case line, ok := <-dataChan:
+			if !ok {
+				return lines
+			}
+			stream := strings.SplitN(string(line), " ", 2)[0]
+			lines[stream] = append(lines[stream], string(line))
+		case <-timeout:
+			t.Fatal("expected the logs to end")
+		}
+	}
+}
+
+func TestProviderContainerLogs(t *testing.T) {
+	long := "out " + strings.Repeat("x", 100*1024)
+
+	var muxed bytes.Buffer
+	stdout := stdcopy.NewStdWriter(&muxed, stdcopy.Stdout)
+	stderr := stdcopy.NewStdWriter(&muxed, stdcopy.Stderr)
+	io.WriteString(stdout, "out 1\n")
+	io.WriteString(stderr, "err 1\n")
+	io.WriteString(stdout, long+"\n")
+	io.WriteString(stdout, "out 2\n")
+	io.WriteString(stderr, "err 2\n")
+
+	var tests = []struct {
+		tty      bool
+		stream   string
+		expected map[string][]string
+	}{
+		{
+			stream: muxed.String(),
+			expected: map[string][]string{
+				"out": {"out 1", long, "out 2"},
+				"err": {"err 1", "err 2"},
+			},
+		},
+		{
+			tty:    true,
+			stream: "out 1\nerr 1\nout 2\n",
+			expected: map[string][]string{
+				"out": {"out 1", "out 2"},
+				"err": {"err 1"},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		var (
+			p   = Provider{Image: "redis:5"}
+			cli = &fakeImageClient{
+				container: &types.Container{ID: "abc"},
+				logs:      ioutil.NopCloser(strings.NewReader(test.stream)),
+				tty:       test.tty,
+			}
+			dataChan = make(chan []byte)
+		)
+
+		stop, err := p.containerLogs(cli, &fakeUnit{}, LogOptions{}, dataChan)
+		if err != nil {
+			t.Fatalf("[test %d] failed to read logs: %s\n", i, err)
+		}
+		lines := readLogs(t, dataChan)
+		stop()
+
+		if !reflect.DeepEqual(lines, test.expected) {
+			t.Errorf("[test %d] expected %d stdout and %d stderr lines, got %d and %d\n",
+				i, len(test.expected["out"]), len(test.expected["err"]), len(lines["out"]), len(lines["err"]))
+		}
+		if !cli.closed {
+			t.Errorf("[test %d] expected the client to be closed\n", i)
+		}
+	}
+}
+
+func TestProviderContainerLogsFollow(t *testing.T) {
+	logsR, logsW := io.Pipe()
+	defer logsW.Close()
+
+	var (
+		p   = Provider{Image: "redis:5"}
+		cli = &fakeImageClient{
+			container: &types.Container{ID: "abc"},
+			logs:      logsR,
+		}
+		dataChan = make(chan []byte)
+	)
+
+	stop, err := p.containerLogs(cli, &fakeUnit{}, LogOptions{Follow: true}, dataChan)
+	if err != nil {
+		t.Fatal("failed to read logs: ", err)
+	}
+
+	go io.WriteString(stdcopy.NewStdWriter(logsW, stdcopy.Stdout), "out 1\n")
+	select {
+	case line := <-dataChan:
+		if string(line) != "out 1" {
+			t.Error("unexpected line: ", string(line))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the container's output")
+	}
+
+	// The container is still running, so the logs only end once they're
+	// stopped.
+	stop()
+	if lines := readLogs(t, dataChan); len(lines) != 0 {
+		t.Error("expected no more lines, got: ", lines)
+	}
+	if !cli.closed {
+		t.Error("expected the client to be closed")
+	}
+}
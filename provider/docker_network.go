@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// networkLabel marks the networks that we created, and so can remove.
+const networkLabel = "com.glorious.network"
+
+// Network is the docker network that the docker units of a config file are
+// connected to, so that they can reach each other by their unit names. It is
+// created when the first of them starts, and removed after the last stops.
+type Network struct {
+	// Name defaults to the project's name.
+	Name   string `hcl:"name"`
+	Driver string `hcl:"driver"`
+
+	// Disable leaves docker units on docker's default bridge network.
+	Disable bool `hcl:"disable"`
+}
+
+// networkMux is held while the network is created or removed, and while
+// containers are connected to it, so a unit that's stopping doesn't remove
+// the network from under one that's starting.
+var networkMux sync.Mutex
+
+// projectNetwork returns the name of the network that the provider's
+// container joins, if it joins one. Containers with their own network_mode
+// are left to it.
+func (p *Provider) projectNetwork() string {
+	if p.project == nil || len(p.NetworkMode) > 0 {
+		return ""
+	}
+
+	n := p.project.Network
+	if n != nil && n.Disable {
+		return ""
+	} else if n == nil || len(n.Name) == 0 {
+		return p.projectName()
+	}
+	return n.Name
+}
+
+// networkingConfig returns the config to connect the provider's container
+// to its network with, aliased by name.
+func (p *Provider) networkingConfig(name string) *network.NetworkingConfig {
+	projectNetwork := p.projectNetwork()
+	if len(projectNetwork) == 0 {
+		return nil
+	}
+
+	return &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			projectNetwork: {Aliases: []string{name}},
+		},
+	}
+}
+
+// ensureNetwork creates the provider's network, if it doesn't exist yet.
+// networkMux must be held.
+func (p *Provider) ensureNetwork(ctx context.Context, cli client.NetworkAPIClient) error {
+	name := p.projectNetwork()
+	if len(name) == 0 {
+		return nil
+	}
+
+	_, err := cli.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if err == nil {
+		return nil
+	} else if !client.IsErrNotFound(err) {
+		return err
+	}
+
+	var driver string
+	if p.project.Network != nil {
+		driver = p.project.Network.Driver
+	}
+	_, err = cli.NetworkCreate(ctx, name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         driver,
+		Labels:         map[string]string{networkLabel: p.projectName()},
+	})
+	return err
+}
+
+// removeNetworkIfUnused removes the provider's network once nothing is
+// connected to it, as long as we created it.
+func (p *Provider) removeNetworkIfUnused(ctx context.Context, cli client.NetworkAPIClient) error {
+	name := p.projectNetwork()
+	if len(name) == 0 {
+		return nil
+	}
+
+	networkMux.Lock()
+	defer networkMux.Unlock()
+
+	resource, err := cli.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if client.IsErrNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if _, ours := resource.Labels[networkLabel]; !ours || len(resource.Containers) > 0 {
+		return nil
+	}
+	if err := cli.NetworkRemove(ctx, name); err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+type fakeNetworkClient struct {
+	client.NetworkAPIClient
+
+	networks map[string]types.NetworkResource
+	created  []types.NetworkCreate
+	removed  []string
+}
+
+func (f *fakeNetworkClient) NetworkInspect(
+	ctx context.Context,
+	name string,
+	options types.NetworkInspectOptions,
+) (types.NetworkResource, error) {
+	resource, ok := f.networks[name]
+	if !ok {
+		return resource, errdefs.NotFound(errors.New("network not found"))
+	}
+	return resource, nil
+}
+
+func (f *fakeNetworkClient) NetworkCreate(
+	ctx context.Context,
+	name string,
+	options types.NetworkCreate,
+) (types.NetworkCreateResponse, error) {
+	f.created = append(f.created, options)
+	f.networks[name] = types.NetworkResource{Name: name, Labels: options.Labels}
+	return types.NetworkCreateResponse{ID: name}, nil
+}
+
+func (f *fakeNetworkClient) NetworkRemove(ctx context.Context, name string) error {
+	f.removed = append(f.removed, name)
+	delete(f.networks, name)
+	return nil
+}
+
+func TestProviderNetworkingConfig(t *testing.T) {
+	var tests = []struct {
+		provider Provider
+		expected *network.NetworkingConfig
+	}{
+		{Provider{}, nil},
+		{Provider{project: &Project{Network: &Network{Disable: true}}}, nil},
+		{Provider{project: &Project{}, NetworkMode: "host"}, nil},
+		{
+			Provider{project: &Project{Name: "shop"}},
+			&network.NetworkingConfig{
+				EndpointsConfig: map[string]*network.EndpointSettings{
+					"shop": {Aliases: []string{"db"}},
+				},
+			},
+		},
+		{
+			Provider{project: &Project{Name: "shop", Network: &Network{Name: "backend"}}},
+			&network.NetworkingConfig{
+				EndpointsConfig: map[string]*network.EndpointSettings{
+					"backend": {Aliases: []string{"db"}},
+				},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		if got := test.provider.networkingConfig("db"); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("[test %d] expected %+v, got %+v\n", i, test.expected, got)
+		}
+	}
+}
+
+func TestProviderNetworkLifecycle(t *testing.T) {
+	var (
+		ctx = context.Background()
+		cli = &fakeNetworkClient{networks: make(map[string]types.NetworkResource)}
+		p   = Provider{project: &Project{Network: &Network{Name: "shop", Driver: "bridge"}}}
+	)
+
+	for i := 0; i < 2; i++ {
+		if err := p.ensureNetwork(ctx, cli); err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+	}
+	if len(cli.created) != 1 || cli.created[0].Driver != "bridge" {
+		t.Fatal("expected the network to be created once, got: ", cli.created)
+	}
+
+	// Containers are still connected to it.
+	resource := cli.networks["shop"]
+	resource.Containers = map[string]types.EndpointResource{"abc": {Name: "db"}}
+	cli.networks["shop"] = resource
+	if err := p.removeNetworkIfUnused(ctx, cli); err != nil {
+		t.Fatal("unexpected error: ", err)
+	} else if len(cli.removed) != 0 {
+		t.Fatal("expected network in use not to be removed")
+	}
+
+	resource.Containers = nil
+	cli.networks["shop"] = resource
+	if err := p.removeNetworkIfUnused(ctx, cli); err != nil {
+		t.Fatal("unexpected error: ", err)
+	} else if !reflect.DeepEqual(cli.removed, []string{"shop"}) {
+		t.Fatal("expected unused network to be removed, got: ", cli.removed)
+	}
+
+	// Networks we didn't create are left alone.
+	cli.networks["shop"] = types.NetworkResource{Name: "shop"}
+	if err := p.removeNetworkIfUnused(ctx, cli); err != nil {
+		t.Fatal("unexpected error: ", err)
+	} else if len(cli.removed) != 1 {
+		t.Fatal("expected network we didn't create not to be removed")
+	}
+}
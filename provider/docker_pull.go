@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/go-units"
+)
+
+// pullProgressInterval is the least time between reports of how a pull is
+// going, so that a pull's many messages don't flood the shell.
+var pullProgressInterval = time.Second
+
+// layerProgress is how far along pulling one of an image's layers is.
+type layerProgress struct {
+	current int64
+	total   int64
+	done    bool
+}
+
+// pullProgress sums up the progress of an image pull across its layers.
+type pullProgress struct {
+	image  string
+	layers map[string]*layerProgress
+}
+
+// update records the progress in msg, returning whether it was about one of
+// the image's layers.
+func (p *pullProgress) update(msg *jsonmessage.JSONMessage) bool {
+	// Messages without an ID are about the whole image, as is the one
+	// saying which repository it's pulled from, whose ID is the tag.
+	if len(msg.ID) == 0 || strings.HasPrefix(msg.Status, "Pulling from") {
+		return false
+	}
+
+	layer, ok := p.layers[msg.ID]
+	if !ok {
+		layer = &layerProgress{}
+		p.layers[msg.ID] = layer
+	}
+
+	switch msg.Status {
+	case "Downloading":
+		if msg.Progress != nil {
+			layer.current, layer.total = msg.Progress.Current, msg.Progress.Total
+		}
+	case "Verifying Checksum", "Download complete", "Extracting":
+		layer.current = layer.total
+	case "Pull complete", "Already exists":
+		layer.current = layer.total
+		layer.done = true
+	}
+	return true
+}
+
+func (p *pullProgress) String() string {
+	var (
+		done           int
+		current, total int64
+	)
+	for _, layer := range p.layers {
+		if layer.done {
+			done++
+		}
+		current += layer.current
+		total += layer.total
+	}
+
+	progress := fmt.Sprintf("pulling %s: %d/%d layers", p.image, done, len(p.layers))
+	if total > 0 {
+		progress += fmt.Sprintf(
+			", %s/%s",
+			units.HumanSize(float64(current)),
+			units.HumanSize(float64(total)),
+		)
+	}
+	return progress
+}
+
+// readPullProgress reads the JSON message stream of an image pull until the
+// pull is done, reporting how it's going every pullProgressInterval. Errors
+// from the registry come in the stream, and are returned as they are.
+func readPullProgress(stream io.Reader, image string, report func(string)) error {
+	var (
+		progress = &pullProgress{
+			image:  image,
+			layers: make(map[string]*layerProgress),
+		}
+		decoder    = json.NewDecoder(stream)
+		lastReport = time.Now()
+	)
+
+	report("pulling " + image)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := decoder.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if msg.Error != nil {
+			return errors.New(msg.Error.Message)
+		} else if len(msg.ErrorMessage) > 0 {
+			return errors.New(msg.ErrorMessage)
+		}
+
+		if progress.update(&msg) && time.Since(lastReport) >= pullProgressInterval {
+			report(progress.String())
+			lastReport = time.Now()
+		}
+	}
+	report("pulled " + image)
+	return nil
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPullStream = `{"status":"Pulling from library/redis","id":"5"}
+{"status":"Pulling fs layer","id":"a1"}
+{"status":"Already exists","id":"b2"}
+{"status":"Downloading","progressDetail":{"current":1000,"total":4000},"id":"a1"}
+{"status":"Download complete","id":"a1"}
+{"status":"Extracting","progressDetail":{"current":4000,"total":4000},"id":"a1"}
+{"status":"Pull complete","id":"a1"}
+{"status":"Digest: sha256:aaa"}
+{"status":"Status: Downloaded newer image for redis:5"}
+`
+
+func TestReadPullProgress(t *testing.T) {
+	oldInterval := pullProgressInterval
+	pullProgressInterval = 0
+	defer func() {
+		pullProgressInterval = oldInterval
+	}()
+
+	var reports []string
+	report := func(msg string) {
+		reports = append(reports, msg)
+	}
+	if err := readPullProgress(strings.NewReader(testPullStream), "redis:5", report); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+
+	expected := []string{
+		"pulling redis:5",
+		"pulling redis:5: 0/1 layers",
+		"pulling redis:5: 1/2 layers",
+		"pulling redis:5: 1/2 layers, 1kB/4kB",
+		"pulling redis:5: 1/2 layers, 4kB/4kB",
+		"pulling redis:5: 1/2 layers, 4kB/4kB",
+		"pulling redis:5: 2/2 layers, 4kB/4kB",
+		"pulled redis:5",
+	}
+	if !reflect.DeepEqual(reports, expected) {
+		t.Errorf("expected reports:\n%s\ngot:\n%s\n",
+			strings.Join(expected, "\n"), strings.Join(reports, "\n"))
+	}
+}
+
+func TestReadPullProgressError(t *testing.T) {
+	stream := `{"status":"Pulling from shop/api","id":"1.4"}
+{"errorDetail":{"message":"manifest for ghcr.io/shop/api:1.4 not found: manifest unknown"},"error":"manifest for ghcr.io/shop/api:1.4 not found: manifest unknown"}
+`
+
+	var reports []string
+	err := readPullProgress(strings.NewReader(stream), "ghcr.io/shop/api:1.4", func(msg string) {
+		reports = append(reports, msg)
+	})
+	if err == nil || err.Error() != "manifest for ghcr.io/shop/api:1.4 not found: manifest unknown" {
+		t.Error("expected the registry's error, got: ", err)
+	}
+	if len(reports) == 0 || reports[len(reports)-1] == "pulled ghcr.io/shop/api:1.4" {
+		t.Error("expected the pull not to be reported as done, got: ", reports)
+	}
+}
+
+func TestProviderPullImage(t *testing.T) {
+	var (
+		p   = Provider{Image: "redis:5"}
+		cli = &fakeImageClient{pullStream: testPullStream}
+		u   = &fakeUnit{}
+	)
+
+	if err := p.pullImage(context.Background(), cli, u, "redis:5"); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if len(cli.pulled) != 1 {
+		t.Error("expected the image to be pulled once, got: ", cli.pulled)
+	}
+	if len(u.progress) < 2 || u.progress[0] != "pulling redis:5" ||
+		u.progress[len(u.progress)-1] != "pulled redis:5" {
+		t.Error("expected the pull's progress to be reported, got: ", u.progress)
+	}
+}
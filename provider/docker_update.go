@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// The update_policy values.
+const (
+	// UpdatePolicyNotify only shows that an update is available.
+	UpdatePolicyNotify = "notify"
+
+	// UpdatePolicyPull pulls the update, which is used once the unit is
+	// next recreated.
+	UpdatePolicyPull = "pull"
+
+	// UpdatePolicyRecreate pulls the update and recreates the unit with
+	// it.
+	UpdatePolicyRecreate = "recreate"
+)
+
+const defaultUpdateInterval = 5 * time.Minute
+
+// UpdateCheckInterval returns how often to check for updates to the unit.
+func (p *Provider) UpdateCheckInterval() (time.Duration, error) {
+	if len(p.UpdateInterval) == 0 {
+		return defaultUpdateInterval, nil
+	}
+
+	interval, err := time.ParseDuration(p.UpdateInterval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid update_interval: %s", err)
+	} else if interval <= 0 {
+		return 0, errors.New("update_interval must be positive")
+	}
+	return interval, nil
+}
+
+func (p *Provider) validateUpdatePolicy() error {
+	switch p.UpdatePolicy {
+	case "", UpdatePolicyNotify, UpdatePolicyPull, UpdatePolicyRecreate:
+	default:
+		return fmt.Errorf(
+			"invalid update_policy %q, must be one of notify, pull or recreate",
+			p.UpdatePolicy,
+		)
+	}
+	_, err := p.UpdateCheckInterval()
+	return err
+}
+
+// UpdateAvailable returns whether the registry has a different image for the
+// unit's tag than the one that its container is running.
+func (d *dockerDriver) UpdateAvailable(p *Provider, u Unit) (bool, error) {
+	cli, err := p.dockerClient()
+	if err != nil {
+		return false, err
+	}
+	defer cli.Close()
+	return p.updateAvailable(context.Background(), cli, u)
+}
+
+// PullUpdate pulls the registry's image for the unit's tag, unless we already
+// have it.
+func (d *dockerDriver) PullUpdate(p *Provider, u Unit) error {
+	cli, err := p.dockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	return p.pullUpdate(context.Background(), cli, u)
+}
+
+func (p *Provider) updateAvailable(ctx context.Context, cli client.CommonAPIClient, u Unit) (bool, error) {
+	c, err := p.findContainer(ctx, cli, u)
+	if err != nil || c == nil {
+		return false, err
+	}
+
+	digest, err := p.registryDigest(ctx, cli, u)
+	if err != nil {
+		return false, err
+	}
+
+	info, _, err := cli.ImageInspectWithRaw(ctx, c.ImageID)
+	if err != nil {
+		return false, err
+	}
+	return !hasDigest(info.RepoDigests, digest), nil
+}
+
+func (p *Provider) pullUpdate(ctx context.Context, cli client.CommonAPIClient, u Unit) error {
+	digest, err := p.registryDigest(ctx, cli, u)
+	if err != nil {
+		return err
+	}
+
+	info, _, err := cli.ImageInspectWithRaw(ctx, p.Image)
+	if err == nil && hasDigest(info.RepoDigests, digest) {
+		return nil
+	} else if err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+
+	u.GetContext().Logger().Infof("pulling %s@%s\n", p.Image, digest)
+	return p.pullImage(ctx, cli, u, p.Image)
+}
+
+// registryDigest returns the digest of the manifest that the registry has
+// for the provider's image, which is asked for with the same credentials
+// that it's pulled with.
+func (p *Provider) registryDigest(ctx context.Context, cli client.DistributionAPIClient, u Unit) (string, error) {
+	inspect, err := cli.DistributionInspect(ctx, p.Image, p.dockerImagePullOptions(u).RegistryAuth)
+	if err != nil {
+		return "", err
+	}
+	return inspect.Descriptor.Digest.String(), nil
+}
+
+// hasDigest returns whether an image's repo digests, which are of the form
+// repository@digest, include digest.
+func hasDigest(repoDigests []string, digest string) bool {
+	for _, repoDigest := range repoDigests {
+		if strings.HasSuffix(repoDigest, "@"+digest) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	digest "github.com/opencontainers/go-digest"
+)
+
+type fakeImageClient struct {
+	client.CommonAPIClient
+
+	container *types.Container
+	images    map[string]types.ImageInspect
+	digest    string
+	pulled    []string
+
+	// pullStream is the JSON message stream of pulls, which fail if it's
+	// empty.
+	pullStream string
+
+	// logs is the container's log stream, which is multiplexed unless
+	// the container has a TTY.
+	logs   io.ReadCloser
+	tty    bool
+	closed bool
+}
+
+func (f *fakeImageClient) ContainerList(
+	ctx context.Context,
+	options types.ContainerListOptions,
+) ([]types.Container, error) {
+	if f.container == nil {
+		return nil, nil
+	}
+	return []types.Container{*f.container}, nil
+}
+
+func (f *fakeImageClient) DistributionInspect(
+	ctx context.Context,
+	image string,
+	encodedRegistryAuth string,
+) (registry.DistributionInspect, error) {
+	var inspect registry.DistributionInspect
+	inspect.Descriptor.Digest = digest.Digest(f.digest)
+	return inspect, nil
+}
+
+func (f *fakeImageClient) ImageInspectWithRaw(
+	ctx context.Context,
+	image string,
+) (types.ImageInspect, []byte, error) {
+	info, ok := f.images[image]
+	if !ok {
+		return info, nil, errdefs.NotFound(errors.New("image not found"))
+	}
+	return info, nil, nil
+}
+
+func (f *fakeImageClient) ImagePull(
+	ctx context.Context,
+	ref string,
+	options types.ImagePullOptions,
+) (io.ReadCloser, error) {
+	f.pulled = append(f.pulled, ref)
+	if len(f.pullStream) == 0 {
+		return nil, errors.New("registry unavailable")
+	}
+	return ioutil.NopCloser(strings.NewReader(f.pullStream)), nil
+}
+
+func TestProviderUpdateAvailable(t *testing.T) {
+	var (
+		ctx = context.Background()
+		p   = Provider{Image: "redis:5"}
+		cli = &fakeImageClient{
+			images: map[string]types.ImageInspect{
+				"sha256:old": {RepoDigests: []string{"redis@sha256:aaa"}},
+			},
+			digest: "sha256:aaa",
+		}
+	)
+
+	if available, err := p.updateAvailable(ctx, cli, &fakeUnit{}); err != nil {
+		t.Fatal("unexpected error: ", err)
+	} else if available {
+		t.Error("expected no update for a unit without a container")
+	}
+
+	cli.container = &types.Container{ID: "abc", ImageID: "sha256:old"}
+	if available, err := p.updateAvailable(ctx, cli, &fakeUnit{}); err != nil {
+		t.Fatal("unexpected error: ", err)
+	} else if available {
+		t.Error("expected no update while the registry has the same image")
+	}
+
+	cli.digest = "sha256:bbb"
+	if available, err := p.updateAvailable(ctx, cli, &fakeUnit{}); err != nil {
+		t.Fatal("unexpected error: ", err)
+	} else if !available {
+		t.Error("expected an update once the registry has a new image")
+	}
+}
+
+func TestProviderPullUpdate(t *testing.T) {
+	var (
+		ctx = context.Background()
+		p   = Provider{Image: "redis:5"}
+		cli = &fakeImageClient{
+			images: map[string]types.ImageInspect{
+				"redis:5": {RepoDigests: []string{"docker.io/library/redis@sha256:bbb"}},
+			},
+			digest: "sha256:bbb",
+		}
+	)
+
+	if err := p.pullUpdate(ctx, cli, &fakeUnit{}); err != nil {
+		t.Fatal("unexpected error: ", err)
+	} else if len(cli.pulled) != 0 {
+		t.Fatal("expected an update that's already been pulled not to be pulled again")
+	}
+
+	cli.digest = "sha256:ccc"
+	if err := p.pullUpdate(ctx, cli, &fakeUnit{}); err == nil {
+		t.Error("expected the pull's error to be returned")
+	}
+	if len(cli.pulled) != 1 || cli.pulled[0] != "redis:5" {
+		t.Error("expected the update to be pulled, got: ", cli.pulled)
+	}
+}
+
+func TestProviderUpdateCheckInterval(t *testing.T) {
+	var tests = []struct {
+		interval string
+		expected string
+		hasErr   bool
+	}{
+		{"", "5m0s", false},
+		{"30s", "30s", false},
+		{"-1m", "", true},
+		{"soon", "", true},
+	}
+
+	for i, test := range tests {
+		p := Provider{UpdateInterval: test.interval}
+		interval, err := p.UpdateCheckInterval()
+		if (err != nil) != test.hasErr {
+			t.Errorf("[test %d] expected error %t, got %v\n", i, test.hasErr, err)
+		} else if err == nil && interval.String() != test.expected {
+			t.Errorf("[test %d] expected %s, got %s\n", i, test.expected, interval)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	gcontext "github.com/ttacon/glorious/context"
+	"github.com/ttacon/glorious/status"
+	"github.com/ttacon/glorious/store"
+)
+
+// Driver is implemented by each provider type, it is what actually runs a
+// slot for a unit.
+type Driver interface {
+	// Start runs the unit as described by the provider config.
+	Start(p *Provider, u Unit) error
+
+	// Stop stops a unit that was started by this driver.
+	Stop(p *Provider, u Unit) error
+
+	// Status returns the current status of the unit, as known by the
+	// driver, or nil if the unit isn't running.
+	Status(p *Provider, u Unit) (*status.Status, error)
+
+	// Logs sends each line of output from the unit to dataChan. The
+	// returned function stops following the output, anything that was
+	// already written is still sent before dataChan is closed, so it
+	// must be read until then.
+	Logs(p *Provider, u Unit, opts LogOptions, dataChan chan []byte) (func(), error)
+
+	// Validate checks that the provider config is usable by the driver.
+	Validate(p *Provider) []error
+}
+
+// Unit is the view of a unit that drivers are given.
+type Unit interface {
+	GetName() string
+	SetRunningStatus(*status.Status, status.StatusCallback)
+	GetStatus() *status.Status
+	OutputFile() (*os.File, error)
+	SavePIDFile(c *exec.Cmd) error
+
+	// ReadPIDFile returns the saved PID file for the unit, or nil if it
+	// doesn't have one.
+	ReadPIDFile() (*PIDFile, error)
+	RemovePIDFile() error
+	InternalStore() *store.Store
+	GetContext() gcontext.Context
+
+	// ProcessExited is called by drivers once a unit they started has
+	// exited, so that it can be restarted if need be.
+	ProcessExited(*status.Status)
+
+	// ForceRecreate is whether the unit is being started with
+	// --force-recreate, in which case anything left over from before,
+	// such as a container, is replaced even if it's up to date.
+	ForceRecreate() bool
+
+	// ReportProgress is called while the unit is being started, with
+	// progress on anything that takes a while, such as pulling an image.
+	ReportProgress(message string)
+}
+
+// StaleChecker is implemented by drivers that can tell when a running unit
+// no longer matches its slot's config, so that starting it again replaces
+// it rather than failing because it's already running.
+type StaleChecker interface {
+	IsStale(p *Provider, u Unit) (bool, error)
+}
+
+// UpdateChecker is implemented by drivers that can tell when there's a newer
+// version of what a running unit was started from, such as a newer image in
+// the registry for the same tag.
+type UpdateChecker interface {
+	// UpdateAvailable returns whether the unit is running an out of
+	// date version.
+	UpdateAvailable(p *Provider, u Unit) (bool, error)
+
+	// PullUpdate fetches the newer version, so that the unit runs it
+	// once it's recreated.
+	PullUpdate(p *Provider, u Unit) error
+}
+
+// LogOptions controls how much of a unit's output is returned by Logs.
+type LogOptions struct {
+	// Lines is the number of existing lines to start from, zero means
+	// start from the beginning of the output.
+	Lines int
+
+	// Follow keeps streaming new output once the existing output has
+	// been read.
+	Follow bool
+
+	// Since only shows output after the given timestamp or relative
+	// duration (i.e. 10m). It is only supported by docker providers as
+	// bash output isn't timestamped.
+	Since string
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+// Register makes a driver available for the given provider type. It panics
+// if called twice for the same type or if the driver is nil, so it is
+// expected to be called from an init function.
+func Register(typ string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if driver == nil {
+		panic("provider: Register driver is nil")
+	} else if _, dup := drivers[typ]; dup {
+		panic(fmt.Sprintf("provider: Register called twice for %q", typ))
+	}
+	drivers[typ] = driver
+}
+
+// Lookup returns the driver registered for the given provider type. Types
+// of the form "plugin/<name>" are looked up as out-of-process plugins.
+func Lookup(typ string) (Driver, bool) {
+	driversMu.RLock()
+	driver, ok := drivers[typ]
+	driversMu.RUnlock()
+
+	if !ok && isPluginType(typ) {
+		return lookupPlugin(strings.TrimPrefix(typ, pluginTypePrefix))
+	}
+	return driver, ok
+}
+
+// Types returns the sorted list of registered provider types.
+func Types() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	types := make([]string, 0, len(drivers))
+	for typ := range drivers {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
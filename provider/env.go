@@ -0,0 +1,207 @@
+package provider
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	gerrors "github.com/ttacon/glorious/errors"
+)
+
+// environment returns the environment to run the provider's command with:
+// base, then the variables from each of its env files, and then those in its
+// environment list, with later values replacing earlier ones.
+//
+// Variables in the environment list that have no value take it from our own
+// environment, as with `docker run -e`.
+func (p *Provider) environment(base []string) ([]string, error) {
+	env := mergeEnv(nil, base...)
+	for _, envFile := range p.EnvFile {
+		vars, err := readEnvFile(envFile)
+		if err != nil {
+			return nil, err
+		}
+		env = mergeEnv(env, vars...)
+	}
+
+	for _, v := range p.Environment {
+		if !strings.Contains(v, "=") {
+			val, ok := os.LookupEnv(v)
+			if !ok {
+				continue
+			}
+			v += "=" + val
+		}
+		env = mergeEnv(env, v)
+	}
+	return env, nil
+}
+
+// localEnvironment returns the environment for commands run on this
+// machine, which inherit ours unless it's cleared.
+func (p *Provider) localEnvironment() ([]string, error) {
+	var base []string
+	if !p.ClearEnvironment {
+		base = os.Environ()
+	}
+	return p.environment(base)
+}
+
+// mergeEnv adds vars to env, replacing the values of any that are already
+// set.
+func mergeEnv(env []string, vars ...string) []string {
+	if env == nil {
+		env = []string{}
+	}
+
+	for _, v := range vars {
+		key := strings.SplitN(v, "=", 2)[0]
+
+		replaced := false
+		for i, existing := range env {
+			if strings.SplitN(existing, "=", 2)[0] == key {
+				env[i] = v
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			env = append(env, v)
+		}
+	}
+	return env
+}
+
+func readEnvFile(path string) ([]string, error) {
+	expanded, err := expandHome(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(expanded)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars, err := parseEnvFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return vars, nil
+}
+
+// parseEnvFile parses a dotenv file, of KEY=VALUE lines. Values can be
+// single quoted, to be taken literally, or double quoted, in which case \n,
+// \t, \" and \\ are unescaped. Blank lines, lines starting with #, comments
+// after unquoted values and a leading `export` are ignored.
+func parseEnvFile(r io.Reader) ([]string, error) {
+	var (
+		vars    []string
+		scanner = bufio.NewScanner(r)
+		lineNum = 0
+	)
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		pieces := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(pieces[0])
+		if len(pieces) != 2 || !validEnvKey(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNum)
+		}
+
+		val, err := parseEnvValue(strings.TrimSpace(pieces[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		vars = append(vars, key+"="+val)
+	}
+	return vars, scanner.Err()
+}
+
+func parseEnvValue(raw string) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", errors.New("unterminated quote")
+		}
+		return raw[1 : end+1], checkEnvTrailer(raw[end+2:])
+	case '"':
+		var val strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			switch {
+			case c == '"':
+				return val.String(), checkEnvTrailer(raw[i+1:])
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					val.WriteByte('\n')
+				case 't':
+					val.WriteByte('\t')
+				case '"', '\\':
+					val.WriteByte(raw[i])
+				default:
+					val.WriteByte('\\')
+					val.WriteByte(raw[i])
+				}
+			default:
+				val.WriteByte(c)
+			}
+		}
+		return "", errors.New("unterminated quote")
+	}
+
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(raw), nil
+}
+
+// checkEnvTrailer checks that nothing but a comment follows a quoted value.
+func checkEnvTrailer(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if len(rest) > 0 && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected %q after quoted value", rest)
+	}
+	return nil
+}
+
+func validEnvKey(key string) bool {
+	return len(key) > 0 && !strings.ContainsAny(key, " \t'\"")
+}
+
+// validateEnvironment checks the provider's environment list and env files.
+func (p *Provider) validateEnvironment() []error {
+	var errs []error
+	for _, v := range p.Environment {
+		if !validEnvKey(strings.SplitN(v, "=", 2)[0]) {
+			errs = append(errs, gerrors.ErrInvalidEnvironment)
+			break
+		}
+	}
+	for _, envFile := range p.EnvFile {
+		if _, err := readEnvFile(envFile); err != nil {
+			errs = append(errs, gerrors.ProviderErr{
+				ProviderType: p.Type,
+				Err:          fmt.Errorf("invalid env_file: %s", err),
+			})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,139 @@
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ttacon/glorious/errors"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	var tests = []struct {
+		contents    string
+		expected    []string
+		expectedErr string
+	}{
+		{"A=1\nB=two words\n", []string{"A=1", "B=two words"}, ""},
+		{"# comment\n\nexport A=1 # trailing\n", []string{"A=1"}, ""},
+		{"A='$HOME \\n # not a comment'", []string{`A=$HOME \n # not a comment`}, ""},
+		{`A="line\nbreak \"quoted\" \$x"`, []string{"A=line\nbreak \"quoted\" \\$x"}, ""},
+		{"A=\nB=a=b", []string{"A=", "B=a=b"}, ""},
+		{"A=1\nnot a var\n", nil, "line 2"},
+		{`A="unterminated`, nil, "line 1: unterminated quote"},
+		{`A='quoted' extra`, nil, "after quoted value"},
+	}
+
+	for i, test := range tests {
+		vars, err := parseEnvFile(strings.NewReader(test.contents))
+		if len(test.expectedErr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("[test %d] expected %q error, got: %v\n", i, test.expectedErr, err)
+			}
+		} else if err != nil {
+			t.Errorf("[test %d] unexpected error: %s\n", i, err)
+		} else if !reflect.DeepEqual(vars, test.expected) {
+			t.Errorf("[test %d] expected %q, got %q\n", i, test.expected, vars)
+		}
+	}
+}
+
+func TestProviderEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		common = filepath.Join(dir, "common.env")
+		local  = filepath.Join(dir, "local.env")
+	)
+	if err := ioutil.WriteFile(common, []byte("A=common\nB=common\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(local, []byte("B=local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("GLORIOUS_TEST_INHERITED", "inherited")
+	defer os.Unsetenv("GLORIOUS_TEST_INHERITED")
+
+	p := &Provider{
+		EnvFile: []string{common, local},
+		Environment: []string{
+			"C=listed",
+			"A=overridden",
+			"GLORIOUS_TEST_INHERITED",
+			"GLORIOUS_TEST_UNSET",
+		},
+	}
+
+	env, err := p.environment([]string{"A=base", "Z=base"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"A=overridden",
+		"Z=base",
+		"B=local",
+		"C=listed",
+		"GLORIOUS_TEST_INHERITED=inherited",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %q, got %q\n", expected, env)
+	}
+
+	p.ClearEnvironment = true
+	p.EnvFile, p.Environment = nil, nil
+	if env, err := p.localEnvironment(); err != nil {
+		t.Error(err)
+	} else if env == nil || len(env) != 0 {
+		t.Errorf("expected an empty environment, got %q\n", env)
+	}
+
+	p.EnvFile = []string{filepath.Join(dir, "missing.env")}
+	if _, err := p.environment(nil); err == nil {
+		t.Error("expected missing env file to fail")
+	}
+}
+
+func TestProviderValidateEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	envFile := filepath.Join(dir, ".env")
+	if err := ioutil.WriteFile(envFile, []byte("A=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		provider Provider
+		numErrs  int
+	}{
+		{Provider{Type: "bash/local", Cmd: "env", Environment: []string{"A=1", "B"}}, 0},
+		{Provider{Type: "bash/local", Cmd: "env", EnvFile: []string{envFile}}, 0},
+		{Provider{Type: "docker/local", Image: "app", EnvFile: []string{envFile}}, 0},
+		{Provider{Type: "bash/local", Cmd: "env", Environment: []string{"=1"}}, 1},
+		{Provider{Type: "bash/local", Cmd: "env", EnvFile: []string{filepath.Join(dir, "missing")}}, 1},
+		{Provider{Type: "docker/local", Image: "app", EnvFile: []string{filepath.Join(dir, "missing")}}, 1},
+	}
+
+	for i, test := range tests {
+		if errs := test.provider.Validate(); len(errs) != test.numErrs {
+			t.Errorf("[test %d] expected %d errors, got %v\n", i, test.numErrs, errs)
+		}
+	}
+
+	errs := (&Provider{Environment: []string{"BAD KEY=1"}}).validateEnvironment()
+	if len(errs) != 1 || errs[0] != errors.ErrInvalidEnvironment {
+		t.Error("expected invalid environment error, got: ", errs)
+	}
+}
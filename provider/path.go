@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolvePaths makes the paths in the provider's config absolute, resolving
+// relative ones against dir, the directory of the config file it was loaded
+// from. A leading ~ and $VARs are expanded first.
+//
+// The working directory of docker units is in the container, and the volume
+// sources of docker/remote units are on the docker host, so both are left
+// alone, as are the names of docker volumes.
+func (p *Provider) ResolvePaths(dir string) error {
+	p.configDir = dir
+
+	var err error
+	if len(p.WorkingDir) > 0 && !strings.HasPrefix(p.Type, "docker/") {
+		if p.WorkingDir, err = resolvePath(p.WorkingDir, dir); err != nil {
+			return err
+		}
+	}
+
+	for i, envFile := range p.EnvFile {
+		if p.EnvFile[i], err = resolvePath(envFile, dir); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Remote.IdentityFile) > 0 {
+		if p.Remote.IdentityFile, err = resolvePath(p.Remote.IdentityFile, dir); err != nil {
+			return err
+		}
+	}
+
+	if p.Type == "docker/remote" {
+		return nil
+	}
+	for i, volume := range p.Volumes {
+		pieces := strings.SplitN(volume, ":", 2)
+		if len(pieces) == 1 || !isBindSource(pieces[0]) {
+			continue
+		}
+		source, err := resolvePath(pieces[0], dir)
+		if err != nil {
+			return err
+		}
+		pieces[0] = source
+		p.Volumes[i] = strings.Join(pieces, ":")
+	}
+	return nil
+}
+
+// resolvePath expands $VARs and a leading ~ in path, and then makes it
+// absolute, relative to dir.
+func resolvePath(path, dir string) (string, error) {
+	path, err := expandHome(os.ExpandEnv(path))
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return filepath.Abs(path)
+}
+
+// expandHome replaces a leading ~ in path with the user's home directory.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~")), nil
+}
@@ -0,0 +1,137 @@
+//go:build !windows
+// +build !windows
+
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProviderResolvePaths(t *testing.T) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GLORIOUS_TEST_CODE", "/srv/code")
+	defer os.Unsetenv("GLORIOUS_TEST_CODE")
+
+	var tests = []struct {
+		provider Provider
+		expected Provider
+	}{
+		{
+			Provider{
+				Type:       "bash/remote",
+				WorkingDir: "app",
+				EnvFile:    []string{".env", "../shared.env"},
+				Remote:     RemoteInfo{IdentityFile: "keys/dev.pem", WorkingDir: "~/app"},
+			},
+			Provider{
+				Type:       "bash/remote",
+				WorkingDir: "/etc/glorious/app",
+				EnvFile:    []string{"/etc/glorious/.env", "/etc/shared.env"},
+				Remote:     RemoteInfo{IdentityFile: "/etc/glorious/keys/dev.pem", WorkingDir: "~/app"},
+				configDir:  "/etc/glorious",
+			},
+		},
+		{
+			Provider{
+				Type:       "bash/local",
+				WorkingDir: "$GLORIOUS_TEST_CODE/app",
+				EnvFile:    []string{"~/.env"},
+			},
+			Provider{
+				Type:       "bash/local",
+				WorkingDir: "/srv/code/app",
+				EnvFile:    []string{filepath.Join(homeDir, ".env")},
+				configDir:  "/etc/glorious",
+			},
+		},
+		{
+			Provider{
+				Type:    "docker/local",
+				Volumes: []string{"./data:/data", "/var/log:/logs:ro", "~/cache:/cache"},
+			},
+			Provider{
+				Type:      "docker/local",
+				Volumes:   []string{"/etc/glorious/data:/data", "/var/log:/logs:ro", filepath.Join(homeDir, "cache") + ":/cache"},
+				configDir: "/etc/glorious",
+			},
+		},
+		// Volumes of remote docker hosts are paths on that host.
+		{
+			Provider{
+				Type:    "docker/remote",
+				Volumes: []string{"./data:/data"},
+			},
+			Provider{
+				Type:      "docker/remote",
+				Volumes:   []string{"./data:/data"},
+				configDir: "/etc/glorious",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		if err := test.provider.ResolvePaths("/etc/glorious"); err != nil {
+			t.Errorf("[test %d] unexpected error: %s\n", i, err)
+		} else if !reflect.DeepEqual(test.provider, test.expected) {
+			t.Errorf("[test %d] expected %+v, got %+v\n", i, test.expected, test.provider)
+		}
+	}
+}
+
+func TestBashCmdWorkingDir(t *testing.T) {
+	var tests = []struct {
+		workingDir string
+		expected   string
+	}{
+		{"", "/etc/glorious"},
+		{"app", "/etc/glorious/app"},
+		{"/srv/app", "/srv/app"},
+	}
+
+	for i, test := range tests {
+		p := Provider{Type: "bash/local", Cmd: "true", WorkingDir: test.workingDir}
+		if err := p.ResolvePaths("/etc/glorious"); err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		}
+
+		c, err := p.BashCmd()
+		if err != nil {
+			t.Errorf("[test %d] unexpected error: %s\n", i, err)
+		} else if c.Dir != test.expected {
+			t.Errorf("[test %d] expected to run in %q, got %q\n", i, test.expected, c.Dir)
+		}
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		path     string
+		expected string
+	}{
+		{"~", homeDir},
+		{"~/code/app", filepath.Join(homeDir, "code", "app")},
+		{"/home/user/code", "/home/user/code"},
+		{"~user/code", "~user/code"},
+		{"code/~/app", "code/~/app"},
+	}
+
+	for i, test := range tests {
+		got, err := expandHome(test.path)
+		if err != nil {
+			t.Errorf("[test %d] unexpected error: %s\n", i, err)
+		} else if got != test.expected {
+			t.Errorf("[test %d] expected %q, got %q\n", i, test.expected, got)
+		}
+	}
+}
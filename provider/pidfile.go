@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// PIDFile is saved for each process that is started, so that it can be
+// found again if the daemon is restarted.
+type PIDFile struct {
+	PID  int      `json:"pid"`
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+
+	// StartTime is when the process started, in whatever form the system
+	// gives it to us, it's empty if that couldn't be found.
+	StartTime string `json:"start_time,omitempty"`
+}
+
+func NewPIDFile(c *exec.Cmd) *PIDFile {
+	startTime, _ := processStartTime(c.Process.Pid)
+	return &PIDFile{
+		PID:       c.Process.Pid,
+		Path:      c.Path,
+		Args:      c.Args,
+		StartTime: startTime,
+	}
+}
+
+// Running returns whether the process is still running, and is still the
+// command that was started rather than something that has since been given
+// the same PID.
+func (p *PIDFile) Running() bool {
+	if !processAlive(p.PID) {
+		return false
+	}
+
+	// A process that started at a different time isn't ours, whatever
+	// its command line.
+	if len(p.StartTime) > 0 {
+		if startTime, err := processStartTime(p.PID); err != nil || startTime != p.StartTime {
+			return false
+		}
+	}
+
+	argv, err := processArgs(p.PID)
+	if err != nil {
+		return false
+	}
+	return p.matches(argv)
+}
+
+// matches returns whether the arguments of a running process are those of
+// the command we started. Scripts are run by their interpreter, which shows
+// up in front of the script's path and the rest of its arguments.
+func (p *PIDFile) matches(argv []string) bool {
+	if script, ok := shellScript(p.Args); ok {
+		// The shell may have replaced itself with the last command
+		// of the script.
+		cmdline := strings.Join(argv, " ")
+		return equalArgs(argv, p.Args) ||
+			(len(cmdline) > 0 && strings.Contains(script, cmdline))
+	}
+
+	args := p.Args
+	if len(args) == 0 {
+		args = []string{p.Path}
+	}
+	if equalArgs(argv, args) {
+		return true
+	}
+
+	// Run through a shebang, the interpreter (and its argument) replaces
+	// our first argument with the script's path.
+	offset := len(argv) - len(args)
+	return offset > 0 &&
+		argv[offset] == p.Path &&
+		equalArgs(argv[offset+1:], args[1:])
+}
+
+func equalArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
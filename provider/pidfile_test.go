@@ -0,0 +1,141 @@
+//go:build !windows
+// +build !windows
+
+package provider
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/ttacon/glorious/status"
+)
+
+func TestPIDFileRunning(t *testing.T) {
+	c := exec.Command("sleep", "30")
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	pidFile := NewPIDFile(c)
+	if !pidFile.Running() {
+		t.Error("expected process to be running")
+	}
+
+	if len(pidFile.StartTime) == 0 {
+		t.Error("expected the process's start time to be recorded")
+	}
+
+	other := *pidFile
+	other.Args = []string{"sleep", "60"}
+	if other.Running() {
+		t.Error("expected a different command not to match")
+	}
+
+	// The same command started at another time is a different process
+	// that has been given the same PID.
+	reused := *pidFile
+	reused.StartTime = "1"
+	if reused.Running() {
+		t.Error("expected a different start time not to match")
+	}
+
+	// Pid files from before start times were recorded still match.
+	legacy := *pidFile
+	legacy.StartTime = ""
+	if !legacy.Running() {
+		t.Error("expected a pid file without a start time to match")
+	}
+
+	_ = c.Process.Kill()
+	_ = c.Wait()
+
+	if pidFile.Running() {
+		t.Error("expected process to have stopped")
+	}
+}
+
+func TestPIDFileMatches(t *testing.T) {
+	var tests = []struct {
+		pidFile  PIDFile
+		argv     []string
+		expected bool
+	}{
+		{PIDFile{Path: "/bin/sleep", Args: []string{"sleep", "30"}}, []string{"sleep", "30"}, true},
+		{PIDFile{Path: "/bin/sleep", Args: []string{"sleep", "30"}}, []string{"sleep", "60"}, false},
+		{PIDFile{Path: "/bin/sleep", Args: []string{"sleep", "30"}}, []string{"sleep", "3", "0"}, false},
+		{PIDFile{Path: "/usr/bin/node", Args: []string{"node", "app.js"}}, []string{"vim", "app.js"}, false},
+		// Commands without arguments match on their whole command line,
+		// not just any that mentions them.
+		{PIDFile{Path: "/usr/bin/top", Args: []string{"top"}}, []string{"top"}, true},
+		{PIDFile{Path: "/usr/bin/top", Args: []string{"top"}}, []string{"vim", "top"}, false},
+		{PIDFile{Path: "/usr/bin/top", Args: []string{"top"}}, []string{"htop"}, false},
+		// Scripts run through their shebang.
+		{PIDFile{Path: "/tmp/ticker.sh"}, []string{"/bin/sh", "/tmp/ticker.sh"}, true},
+		{PIDFile{Path: "/tmp/ticker.sh", Args: []string{"ticker.sh", "-v"}}, []string{"/usr/bin/env", "bash", "/tmp/ticker.sh", "-v"}, true},
+		{PIDFile{Path: "/tmp/ticker.sh", Args: []string{"ticker.sh", "-v"}}, []string{"/bin/sh", "/tmp/ticker.sh"}, false},
+		{PIDFile{Path: "/tmp/ticker.sh"}, []string{"vim", "/tmp/other.sh"}, false},
+		// Shell form commands, before and after the shell replaces itself
+		// with the last command of the script.
+		{PIDFile{Path: "/bin/sh", Args: []string{"/bin/sh", "-c", "npm i && npm start"}}, []string{"/bin/sh", "-c", "npm i && npm start"}, true},
+		{PIDFile{Path: "/bin/sh", Args: []string{"/bin/sh", "-c", "PORT=3000 npm start"}}, []string{"npm", "start"}, true},
+		{PIDFile{Path: "/bin/sh", Args: []string{"/bin/sh", "-c", "PORT=3000 npm start"}}, []string{"npm", "test"}, false},
+		{PIDFile{Path: "/bin/sh", Args: []string{"/bin/sh", "-c", "npm start"}}, nil, false},
+	}
+
+	for i, test := range tests {
+		if got := test.pidFile.matches(test.argv); got != test.expected {
+			t.Errorf("[test %d] expected %v, got %v\n", i, test.expected, got)
+		}
+	}
+}
+
+func TestBashDriverReattach(t *testing.T) {
+	oldInterval := pidPollInterval
+	pidPollInterval = 10 * time.Millisecond
+	defer func() {
+		pidPollInterval = oldInterval
+	}()
+
+	c := exec.Command("sleep", "30")
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Process.Kill()
+
+	u := &fakeUnit{
+		pidFile: NewPIDFile(c),
+		exited:  make(chan *status.Status, 1),
+	}
+
+	stat, err := newBashDriver(false).Status(&Provider{Type: "bash/local"}, u)
+	if err != nil {
+		t.Fatal(err)
+	} else if stat == nil {
+		t.Fatal("expected to reattach to running process")
+	}
+
+	stat.Lock()
+	if stat.CurrentStatus != status.Running {
+		t.Error("expected reattached process to be running, got: ", stat)
+	} else if stat.Cmd.Process.Pid != c.Process.Pid {
+		t.Error("reattached to unexpected pid: ", stat.Cmd.Process.Pid)
+	}
+	stat.Unlock()
+
+	_ = c.Process.Kill()
+	_ = c.Wait()
+
+	select {
+	case exited := <-u.exited:
+		if exited.CurrentStatus != status.Crashed {
+			t.Error("expected process to have crashed, got: ", exited)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("process exit was never noticed")
+	}
+
+	if u.pidFile != nil {
+		t.Error("expected pid file to be removed")
+	}
+}
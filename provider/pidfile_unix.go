@@ -0,0 +1,66 @@
+//go:build !windows
+// +build !windows
+
+package provider
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func procFile(pid int, name string) ([]byte, error) {
+	return ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/" + name)
+}
+
+// processArgs returns the arguments the process was started with.
+func processArgs(pid int) ([]string, error) {
+	if raw, err := procFile(pid, "cmdline"); err == nil {
+		raw = bytes.TrimSuffix(raw, []byte{0})
+		if len(raw) == 0 {
+			return nil, nil
+		}
+		return strings.Split(string(raw), "\x00"), nil
+	}
+
+	// No procfs (i.e. macOS), so fall back to ps, which can't tell us
+	// where arguments containing spaces start and end.
+	out, err := exec.Command("ps", "-o", "command=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// processStartTime returns when the process started, as the number of clock
+// ticks since boot from procfs, or as ps prints it.
+func processStartTime(pid int) (string, error) {
+	if raw, err := procFile(pid, "stat"); err == nil {
+		// The command name comes second, in parentheses, and may
+		// contain anything at all. Start time is the 22nd field.
+		end := bytes.LastIndexByte(raw, ')')
+		if end < 0 {
+			return "", errors.New("invalid process stat")
+		}
+		fields := strings.Fields(string(raw[end+1:]))
+		if len(fields) < 20 {
+			return "", errors.New("invalid process stat")
+		}
+		return fields[19], nil
+	}
+
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
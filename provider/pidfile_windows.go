@@ -0,0 +1,17 @@
+package provider
+
+import "errors"
+
+// Reattaching to processes isn't supported on Windows yet, so processes are
+// never considered alive.
+func processAlive(pid int) bool {
+	return false
+}
+
+func processArgs(pid int) ([]string, error) {
+	return nil, errors.New("not supported on windows")
+}
+
+func processStartTime(pid int) (string, error) {
+	return "", errors.New("not supported on windows")
+}
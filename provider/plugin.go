@@ -0,0 +1,354 @@
+package provider
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	gerrors "github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/provider/plugin"
+	"github.com/ttacon/glorious/status"
+)
+
+const pluginTypePrefix = "plugin/"
+
+var (
+	pluginsMux = new(sync.Mutex)
+	plugins    = make(map[string]*pluginDriver)
+
+	// findPlugin returns the path of the binary for the named plugin.
+	findPlugin = func(name string) (string, error) {
+		bin := "glorious-provider-" + name
+
+		if home := os.Getenv("HOME"); len(home) > 0 {
+			path := filepath.Join(home, ".glorious", "plugins", bin)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, nil
+			}
+		}
+
+		return exec.LookPath(bin)
+	}
+)
+
+// lookupPlugin returns the driver for the named plugin, if the plugin's
+// binary can be found. The plugin process itself isn't started until the
+// driver is first used.
+func lookupPlugin(name string) (Driver, bool) {
+	pluginsMux.Lock()
+	defer pluginsMux.Unlock()
+
+	if driver, ok := plugins[name]; ok {
+		return driver, true
+	}
+
+	path, err := findPlugin(name)
+	if err != nil {
+		return nil, false
+	}
+
+	driver := &pluginDriver{
+		name: name,
+		path: path,
+		mux:  new(sync.Mutex),
+	}
+	plugins[name] = driver
+
+	return driver, true
+}
+
+// pluginDriver proxies all calls to an out-of-process plugin. A single
+// plugin process is shared by every slot using the plugin.
+type pluginDriver struct {
+	name string
+	path string
+
+	mux    *sync.Mutex
+	cmd    *exec.Cmd
+	client *plugin.Client
+
+	// exited is closed once the plugin process has exited.
+	exited chan struct{}
+}
+
+func (d *pluginDriver) getClient() (*plugin.Client, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	cmd := exec.Command(d.path)
+	cmd.Env = append(
+		os.Environ(),
+		plugin.MagicCookieKey+"="+plugin.MagicCookieValue,
+	)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	client, err := plugin.NewClient(plugin.NewStdio(stdout, stdin))
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, err
+	}
+
+	exited := make(chan struct{})
+	d.cmd = cmd
+	d.client = client
+	d.exited = exited
+
+	// If the plugin exits we'll start it again on the next call.
+	go func() {
+		_ = cmd.Wait()
+
+		d.mux.Lock()
+		if d.cmd == cmd {
+			d.cmd = nil
+			d.client = nil
+			d.exited = nil
+		}
+		d.mux.Unlock()
+		close(exited)
+	}()
+
+	return client, nil
+}
+
+// kill kills the plugin process, if it's running, and waits for it to exit.
+func (d *pluginDriver) kill() {
+	d.mux.Lock()
+	cmd, client, exited := d.cmd, d.client, d.exited
+	d.mux.Unlock()
+
+	if cmd == nil {
+		return
+	}
+	_ = client.Close()
+	_ = cmd.Process.Kill()
+	<-exited
+}
+
+// Shutdown kills every plugin process that has been started. It should be
+// called before exiting, as plugins are otherwise left running. A plugin
+// that's used again afterwards is started again.
+func Shutdown() {
+	pluginsMux.Lock()
+	drivers := make([]*pluginDriver, 0, len(plugins))
+	for _, driver := range plugins {
+		drivers = append(drivers, driver)
+	}
+	pluginsMux.Unlock()
+
+	for _, driver := range drivers {
+		driver.kill()
+	}
+}
+
+func (p *Provider) pluginConfig() plugin.Config {
+	config := plugin.Config{
+		"type": p.Type,
+	}
+	for key, val := range p.Extra {
+		config[key] = val
+	}
+
+	if p.Cmd != nil {
+		config["cmd"] = p.Cmd
+	}
+	if len(p.WorkingDir) > 0 {
+		config["workingDir"] = p.WorkingDir
+	}
+	if len(p.Image) > 0 {
+		config["image"] = p.Image
+	}
+	if len(p.Ports) > 0 {
+		config["ports"] = p.Ports
+	}
+	if len(p.Volumes) > 0 {
+		config["volumes"] = p.Volumes
+	}
+	if len(p.Environment) > 0 {
+		config["environment"] = p.Environment
+	}
+	if len(p.EnvFile) > 0 {
+		config["env_file"] = p.EnvFile
+	}
+	if p.ClearEnvironment {
+		config["clear_environment"] = true
+	}
+
+	return config
+}
+
+func (d *pluginDriver) Start(p *Provider, u Unit) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	if err := client.Start(u.GetName(), p.pluginConfig()); err != nil {
+		return err
+	}
+
+	u.SetRunningStatus(status.NewRunningStatus(nil, nil), nil)
+	return nil
+}
+
+func (d *pluginDriver) Stop(p *Provider, u Unit) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	if err := client.Stop(u.GetName(), p.pluginConfig()); err != nil {
+		return err
+	}
+
+	if stat := u.GetStatus(); stat != nil {
+		stat.Stop()
+	}
+	return nil
+}
+
+func (d *pluginDriver) Status(p *Provider, u Unit) (*status.Status, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pluginStatus, err := client.Status(u.GetName(), p.pluginConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	var current status.UnitStatus
+	switch pluginStatus {
+	case plugin.StatusRunning:
+		current = status.Running
+	case plugin.StatusStopped:
+		current = status.Stopped
+	case plugin.StatusCrashed:
+		current = status.Crashed
+	default:
+		return nil, nil
+	}
+
+	if stat := u.GetStatus(); stat != nil && stat.CurrentStatus == current {
+		return stat, nil
+	} else if stat != nil && current == status.Running && stat.IsRunning() {
+		// Keep hold of the unit's health.
+		return stat, nil
+	}
+
+	stat := status.NewRunningStatus(nil, nil)
+	stat.CurrentStatus = current
+	return stat, nil
+}
+
+// pluginLogsPollInterval is how often plugins are asked for new output
+// when following logs.
+var pluginLogsPollInterval = time.Second
+
+func (d *pluginDriver) Logs(
+	p *Provider,
+	u Unit,
+	opts LogOptions,
+	dataChan chan []byte,
+) (func(), error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		config     = p.pluginConfig()
+		pluginOpts = plugin.LogOptions{
+			Lines: opts.Lines,
+			Since: opts.Since,
+		}
+	)
+
+	// Fetch the first batch up front so that errors are returned to
+	// the caller.
+	lines, cursor, err := client.Logs(u.GetName(), config, pluginOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(dataChan)
+
+		for {
+			for _, line := range lines {
+				dataChan <- []byte(line)
+			}
+
+			if !opts.Follow {
+				return
+			}
+
+			select {
+			case <-done:
+				return
+			case <-time.After(pluginLogsPollInterval):
+			}
+
+			pluginOpts.Cursor = cursor
+			if lines, cursor, err = client.Logs(u.GetName(), config, pluginOpts); err != nil {
+				u.GetContext().Logger().Debug("failed to retrieve plugin logs, err: ", err)
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}, nil
+}
+
+func (d *pluginDriver) Validate(p *Provider) []error {
+	client, err := d.getClient()
+	if err != nil {
+		return []error{gerrors.ProviderErr{ProviderType: p.Type, Err: err}}
+	}
+
+	rawErrs, err := client.Validate(p.pluginConfig())
+	if err != nil {
+		return []error{gerrors.ProviderErr{ProviderType: p.Type, Err: err}}
+	}
+
+	var errs []error
+	for _, rawErr := range rawErrs {
+		errs = append(errs, gerrors.ProviderErr{
+			ProviderType: p.Type,
+			Err:          errors.New(rawErr),
+		})
+	}
+	return errs
+}
+
+func isPluginType(typ string) bool {
+	return strings.HasPrefix(typ, pluginTypePrefix)
+}
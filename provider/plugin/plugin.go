@@ -0,0 +1,317 @@
+// Package plugin implements the protocol used to talk to out-of-process
+// provider plugins.
+//
+// A plugin is a binary named glorious-provider-<name>, found either in
+// ~/.glorious/plugins or on the PATH, that is used for providers of type
+// "plugin/<name>". glorious starts the binary and speaks JSON-RPC with it
+// over its stdin and stdout, plugin authors only need to implement Provider
+// and call Serve from main.
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"time"
+)
+
+const (
+	// ProtocolVersion is bumped whenever the RPC protocol changes in an
+	// incompatible way.
+	ProtocolVersion = 1
+
+	// MagicCookieKey and MagicCookieValue are set in the environment of
+	// plugins started by glorious, this stops plugins from being run
+	// directly by mistake.
+	MagicCookieKey   = "GLORIOUS_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue = "c7bbd3cc-9b6a-4a5b-8a3e-0a1f9c4a6a2e"
+
+	// ServiceName is the name the plugin's RPC methods are served under.
+	ServiceName = "Plugin"
+)
+
+// HandshakeTimeout is how long a plugin has to answer the handshake, plugins
+// that take longer are given up on.
+var HandshakeTimeout = 10 * time.Second
+
+// Config is the provider block for a slot. It contains the fields from the
+// provider's `extra` block along with any common provider fields (i.e. cmd,
+// workingDir and image) that were set.
+type Config map[string]interface{}
+
+// Status is the state of a unit as reported by a plugin.
+type Status string
+
+const (
+	StatusNotStarted Status = "not started"
+	StatusRunning    Status = "running"
+	StatusStopped    Status = "stopped"
+	StatusCrashed    Status = "crashed"
+)
+
+// LogOptions controls which output lines are returned by Provider.Logs.
+type LogOptions struct {
+	// Lines is the number of existing lines to return on the first
+	// call, zero means return all of them.
+	Lines int
+
+	// Since only returns output after the given timestamp or relative
+	// duration, if the plugin supports it.
+	Since string
+
+	// Cursor is the value returned by the previous call to Logs, it is
+	// empty on the first call.
+	Cursor string
+}
+
+// Provider is implemented by plugins.
+type Provider interface {
+	Validate(config Config) []error
+	Start(unit string, config Config) error
+	Stop(unit string, config Config) error
+	Status(unit string, config Config) (Status, error)
+
+	// Logs returns the lines of output after opts.Cursor along with
+	// the cursor to use to fetch the next batch of lines.
+	Logs(unit string, config Config, opts LogOptions) ([]string, string, error)
+}
+
+type HandshakeRequest struct {
+	ProtocolVersion int
+}
+
+type HandshakeResponse struct {
+	ProtocolVersion int
+}
+
+type UnitRequest struct {
+	Unit   string
+	Config Config
+}
+
+type ValidateResponse struct {
+	Errors []string
+}
+
+type ErrResponse struct {
+	Err string
+}
+
+type StatusResponse struct {
+	Status Status
+	Err    string
+}
+
+type LogsRequest struct {
+	Unit    string
+	Config  Config
+	Options LogOptions
+}
+
+type LogsResponse struct {
+	Lines  []string
+	Cursor string
+	Err    string
+}
+
+// Server exposes a Provider over RPC.
+type Server struct {
+	impl Provider
+}
+
+func (s *Server) Handshake(req HandshakeRequest, resp *HandshakeResponse) error {
+	resp.ProtocolVersion = ProtocolVersion
+	return nil
+}
+
+func (s *Server) Validate(req UnitRequest, resp *ValidateResponse) error {
+	for _, err := range s.impl.Validate(req.Config) {
+		resp.Errors = append(resp.Errors, err.Error())
+	}
+	return nil
+}
+
+func (s *Server) Start(req UnitRequest, resp *ErrResponse) error {
+	if err := s.impl.Start(req.Unit, req.Config); err != nil {
+		resp.Err = err.Error()
+	}
+	return nil
+}
+
+func (s *Server) Stop(req UnitRequest, resp *ErrResponse) error {
+	if err := s.impl.Stop(req.Unit, req.Config); err != nil {
+		resp.Err = err.Error()
+	}
+	return nil
+}
+
+func (s *Server) Status(req UnitRequest, resp *StatusResponse) error {
+	stat, err := s.impl.Status(req.Unit, req.Config)
+	if err != nil {
+		resp.Err = err.Error()
+	}
+	resp.Status = stat
+	return nil
+}
+
+func (s *Server) Logs(req LogsRequest, resp *LogsResponse) error {
+	lines, cursor, err := s.impl.Logs(req.Unit, req.Config, req.Options)
+	if err != nil {
+		resp.Err = err.Error()
+	}
+	resp.Lines = lines
+	resp.Cursor = cursor
+	return nil
+}
+
+// Serve serves the provider over stdin and stdout until glorious hangs up.
+// It is meant to be called from a plugin's main function.
+func Serve(impl Provider) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return errors.New(
+			"this binary is a glorious plugin, it is not meant to be run directly",
+		)
+	}
+
+	return ServeConn(impl, stdio{os.Stdin, os.Stdout})
+}
+
+// ServeConn serves the provider over the given connection, it returns once
+// the connection is closed.
+func ServeConn(impl Provider, conn io.ReadWriteCloser) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(ServiceName, &Server{impl: impl}); err != nil {
+		return err
+	}
+
+	server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	return nil
+}
+
+// Client talks to a plugin over RPC.
+type Client struct {
+	rpc *rpc.Client
+}
+
+// NewClient performs the handshake with the plugin on the other end of the
+// connection. The connection is closed if the handshake fails or the plugin
+// doesn't answer within HandshakeTimeout.
+func NewClient(conn io.ReadWriteCloser) (*Client, error) {
+	c := &Client{
+		rpc: jsonrpc.NewClient(conn),
+	}
+
+	var resp HandshakeResponse
+	call := c.rpc.Go(
+		ServiceName+".Handshake",
+		HandshakeRequest{ProtocolVersion: ProtocolVersion},
+		&resp,
+		nil,
+	)
+
+	timer := time.NewTimer(HandshakeTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-call.Done:
+	case <-timer.C:
+		_ = c.Close()
+		return nil, fmt.Errorf(
+			"plugin did not answer the handshake within %s",
+			HandshakeTimeout,
+		)
+	}
+
+	if err := call.Error; err != nil {
+		_ = c.Close()
+		return nil, err
+	} else if resp.ProtocolVersion != ProtocolVersion {
+		_ = c.Close()
+		return nil, fmt.Errorf(
+			"plugin speaks protocol version %d, expected %d",
+			resp.ProtocolVersion,
+			ProtocolVersion,
+		)
+	}
+
+	return c, nil
+}
+
+func (c *Client) call(method string, req, resp interface{}) error {
+	return c.rpc.Call(ServiceName+"."+method, req, resp)
+}
+
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+func (c *Client) Validate(config Config) ([]string, error) {
+	var resp ValidateResponse
+	if err := c.call("Validate", UnitRequest{Config: config}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Errors, nil
+}
+
+func (c *Client) Start(unit string, config Config) error {
+	var resp ErrResponse
+	if err := c.call("Start", UnitRequest{unit, config}, &resp); err != nil {
+		return err
+	} else if len(resp.Err) > 0 {
+		return errors.New(resp.Err)
+	}
+	return nil
+}
+
+func (c *Client) Stop(unit string, config Config) error {
+	var resp ErrResponse
+	if err := c.call("Stop", UnitRequest{unit, config}, &resp); err != nil {
+		return err
+	} else if len(resp.Err) > 0 {
+		return errors.New(resp.Err)
+	}
+	return nil
+}
+
+func (c *Client) Status(unit string, config Config) (Status, error) {
+	var resp StatusResponse
+	if err := c.call("Status", UnitRequest{unit, config}, &resp); err != nil {
+		return "", err
+	} else if len(resp.Err) > 0 {
+		return "", errors.New(resp.Err)
+	}
+	return resp.Status, nil
+}
+
+func (c *Client) Logs(unit string, config Config, opts LogOptions) ([]string, string, error) {
+	var resp LogsResponse
+	if err := c.call("Logs", LogsRequest{unit, config, opts}, &resp); err != nil {
+		return nil, "", err
+	} else if len(resp.Err) > 0 {
+		return nil, "", errors.New(resp.Err)
+	}
+	return resp.Lines, resp.Cursor, nil
+}
+
+// stdio joins a reader and writer into a single connection.
+type stdio struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (s stdio) Close() error {
+	rerr := s.ReadCloser.Close()
+	if werr := s.WriteCloser.Close(); werr != nil {
+		return werr
+	}
+	return rerr
+}
+
+// NewStdio joins the reader and writer into a single connection, this is
+// used to talk to a plugin over its stdout and stdin.
+func NewStdio(r io.ReadCloser, w io.WriteCloser) io.ReadWriteCloser {
+	return stdio{r, w}
+}
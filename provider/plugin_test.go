@@ -0,0 +1,236 @@
+package provider
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ttacon/glorious/provider/plugin"
+	"github.com/ttacon/glorious/status"
+)
+
+func TestMain(m *testing.M) {
+	// When started as a plugin by the tests below, serve the fake plugin
+	// instead of running the tests.
+	if os.Getenv("GLORIOUS_TEST_PLUGIN") == "1" {
+		if err := plugin.Serve(newTestPlugin()); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Or as a plugin that never answers the handshake, which says where
+	// to find it first.
+	if pidFile := os.Getenv("GLORIOUS_TEST_HUNG_PLUGIN"); len(pidFile) > 0 {
+		pid := []byte(strconv.Itoa(os.Getpid()))
+		if err := ioutil.WriteFile(pidFile, pid, 0644); err != nil {
+			os.Exit(1)
+		}
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+
+	// Likewise, when started as a docker credential helper.
+	if os.Getenv("GLORIOUS_TEST_CREDENTIAL_HELPER") == "1" {
+		os.Exit(fakeCredentialHelper())
+	}
+
+	os.Exit(m.Run())
+}
+
+type testPlugin struct {
+	mux     *sync.Mutex
+	running map[string]bool
+}
+
+func newTestPlugin() *testPlugin {
+	return &testPlugin{
+		mux:     new(sync.Mutex),
+		running: make(map[string]bool),
+	}
+}
+
+func (t *testPlugin) Validate(config plugin.Config) []error {
+	if _, ok := config["greeting"]; !ok {
+		return []error{errors.New("must provide greeting")}
+	}
+	return nil
+}
+
+func (t *testPlugin) Start(unit string, config plugin.Config) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if t.running[unit] {
+		return errors.New("already running")
+	}
+	t.running[unit] = true
+	return nil
+}
+
+func (t *testPlugin) Stop(unit string, config plugin.Config) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.running[unit] = false
+	return nil
+}
+
+func (t *testPlugin) Status(unit string, config plugin.Config) (plugin.Status, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if t.running[unit] {
+		return plugin.StatusRunning, nil
+	}
+	return plugin.StatusStopped, nil
+}
+
+func (t *testPlugin) Logs(
+	unit string,
+	config plugin.Config,
+	opts plugin.LogOptions,
+) ([]string, string, error) {
+	if len(opts.Cursor) > 0 {
+		return nil, opts.Cursor, nil
+	}
+
+	lines := []string{"hello", config["greeting"].(string)}
+	return lines, strconv.Itoa(len(lines)), nil
+}
+
+func TestPluginDriver(t *testing.T) {
+	os.Setenv("GLORIOUS_TEST_PLUGIN", "1")
+	defer os.Unsetenv("GLORIOUS_TEST_PLUGIN")
+
+	oldFindPlugin := findPlugin
+	findPlugin = func(name string) (string, error) {
+		if name != "test" {
+			return "", errors.New("not found")
+		}
+		return os.Args[0], nil
+	}
+	defer func() {
+		findPlugin = oldFindPlugin
+	}()
+
+	if errs := (&Provider{Type: "plugin/missing"}).Validate(); len(errs) != 1 {
+		t.Error("expected missing plugin to fail validation, got: ", errs)
+	}
+
+	if errs := (&Provider{Type: "plugin/test"}).Validate(); len(errs) != 1 {
+		t.Error("expected plugin to validate its own fields, got: ", errs)
+	}
+
+	p := &Provider{
+		Type: "plugin/test",
+		Extra: map[string]interface{}{
+			"greeting": "world",
+		},
+	}
+	if errs := p.Validate(); len(errs) != 0 {
+		t.Fatal("unexpected validation errors: ", errs)
+	}
+
+	driver, _ := Lookup(p.Type)
+	u := &fakeUnit{}
+
+	if err := driver.Start(p, u); err != nil {
+		t.Fatal("failed to start unit: ", err)
+	} else if err := driver.Start(p, u); err == nil {
+		t.Error("expected plugin error to be returned")
+	}
+
+	if stat, err := driver.Status(p, u); err != nil {
+		t.Error("failed to retrieve status: ", err)
+	} else if stat == nil || stat.CurrentStatus != status.Running {
+		t.Error("expected unit to be running, got: ", stat)
+	}
+
+	dataChan := make(chan []byte, 5)
+	stop, err := driver.Logs(p, u, LogOptions{}, dataChan)
+	if err != nil {
+		t.Fatal("failed to retrieve logs: ", err)
+	}
+	defer stop()
+
+	var lines []string
+	for line := range dataChan {
+		lines = append(lines, string(line))
+	}
+	if len(lines) != 2 || lines[0] != "hello" || lines[1] != "world" {
+		t.Error("unexpected log lines: ", lines)
+	}
+
+	if err := driver.Stop(p, u); err != nil {
+		t.Error("failed to stop unit: ", err)
+	}
+	if stat, err := driver.Status(p, u); err != nil {
+		t.Error("failed to retrieve status: ", err)
+	} else if stat == nil || stat.CurrentStatus != status.Stopped {
+		t.Error("expected unit to be stopped, got: ", stat)
+	}
+
+	// Shutting down kills the plugin, which is started again if it's
+	// used afterwards.
+	pd := driver.(*pluginDriver)
+	pd.mux.Lock()
+	proc := pd.cmd.Process
+	pd.mux.Unlock()
+
+	Shutdown()
+	if err := proc.Signal(syscall.Signal(0)); err == nil {
+		t.Error("expected the plugin process to be killed")
+	}
+	if errs := p.Validate(); len(errs) != 0 {
+		t.Error("unexpected validation errors after shutting down: ", errs)
+	}
+	Shutdown()
+}
+
+func TestPluginHandshakeTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glorious-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pidFile := filepath.Join(dir, "pid")
+	os.Setenv("GLORIOUS_TEST_HUNG_PLUGIN", pidFile)
+	defer os.Unsetenv("GLORIOUS_TEST_HUNG_PLUGIN")
+
+	oldTimeout := plugin.HandshakeTimeout
+	plugin.HandshakeTimeout = 200 * time.Millisecond
+	defer func() {
+		plugin.HandshakeTimeout = oldTimeout
+	}()
+
+	d := &pluginDriver{name: "hung", path: os.Args[0], mux: new(sync.Mutex)}
+	start := time.Now()
+	if _, err := d.getClient(); err == nil {
+		t.Fatal("expected the handshake to time out")
+	} else if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Error("expected the handshake to give up quickly, took: ", elapsed)
+	}
+
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal("expected the plugin to have been started: ", err)
+	}
+	pid, err := strconv.Atoi(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proc, err := os.FindProcess(pid); err == nil {
+		if err := proc.Signal(syscall.Signal(0)); err == nil {
+			_ = proc.Kill()
+			t.Error("expected the plugin process to be killed")
+		}
+	}
+}
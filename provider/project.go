@@ -0,0 +1,139 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// DefaultProjectName is the name of projects that aren't given one, and
+// whose config file's directory doesn't make one.
+const DefaultProjectName = "glorious"
+
+// The labels that we put on the containers we create, so that we can find
+// them again.
+const (
+	projectLabel    = "com.glorious.project"
+	unitLabel       = "com.glorious.unit"
+	slotLabel       = "com.glorious.slot"
+	configHashLabel = "com.glorious.config-hash"
+)
+
+// Project is what the providers of a config file share: the name that
+// their containers are scoped by, and the network they're connected to.
+type Project struct {
+	Name    string
+	Network *Network
+}
+
+// ProjectName makes name, such as that of a config file's directory, into a
+// project name that can be used in container names.
+func ProjectName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '-' || r == '_':
+			if b.Len() > 0 {
+				b.WriteRune(r)
+			}
+		default:
+			if b.Len() > 0 {
+				b.WriteRune('-')
+			}
+		}
+	}
+
+	projectName := strings.TrimRight(b.String(), "-_")
+	if len(projectName) == 0 {
+		return DefaultProjectName
+	}
+	return projectName
+}
+
+// SetProject sets the project that the provider belongs to, and the name of
+// the slot that it's for.
+func (p *Provider) SetProject(project *Project, slot string) {
+	p.project = project
+	p.slot = slot
+}
+
+func (p *Provider) projectName() string {
+	if p.project == nil || len(p.project.Name) == 0 {
+		return DefaultProjectName
+	}
+	return p.project.Name
+}
+
+// containerName returns the name of the unit's container, which is scoped by
+// the project so that other checkouts of it don't collide with ours.
+func (p *Provider) containerName(u Unit) string {
+	return p.projectName() + "-" + u.GetName()
+}
+
+// containerLabels returns the labels for the unit's container: those from
+// the config, and ours. The slot is only labeled if it has a name.
+func (p *Provider) containerLabels(u Unit, configHash string) map[string]string {
+	labels := make(map[string]string)
+	for key, val := range p.Labels {
+		labels[key] = val
+	}
+	labels[projectLabel] = p.projectName()
+	labels[unitLabel] = u.GetName()
+	if len(p.slot) > 0 {
+		labels[slotLabel] = p.slot
+	}
+	labels[configHashLabel] = configHash
+	return labels
+}
+
+// configHash returns a hash of everything that a container is created with.
+func configHash(
+	config *container.Config,
+	hostConfig *container.HostConfig,
+	networkingConfig *network.NetworkingConfig,
+) (string, error) {
+	raw, err := json.Marshal([]interface{}{config, hostConfig, networkingConfig})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// upToDate returns whether the container is running, and was created from
+// the config with the given hash.
+func upToDate(c *types.Container, hash string) bool {
+	return c.State == "running" && c.Labels[configHashLabel] == hash
+}
+
+// findContainer returns the unit's container, which is found by its labels,
+// or nil if it doesn't have one.
+func (p *Provider) findContainer(
+	ctx context.Context,
+	cli client.ContainerAPIClient,
+	u Unit,
+) (*types.Container, error) {
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", projectLabel+"="+p.projectName()),
+			filters.Arg("label", unitLabel+"="+u.GetName()),
+		),
+	})
+	if err != nil {
+		return nil, err
+	} else if len(containers) == 0 {
+		return nil, nil
+	}
+	return &containers[0], nil
+}
@@ -0,0 +1,171 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+type fakeContainerClient struct {
+	client.ContainerAPIClient
+
+	containers []types.Container
+	options    types.ContainerListOptions
+}
+
+func (f *fakeContainerClient) ContainerList(
+	ctx context.Context,
+	options types.ContainerListOptions,
+) ([]types.Container, error) {
+	f.options = options
+
+	var containers []types.Container
+	for _, c := range f.containers {
+		matches := true
+		for _, label := range options.Filters.Get("label") {
+			matches = matches && hasLabel(c.Labels, label)
+		}
+		if matches {
+			containers = append(containers, c)
+		}
+	}
+	return containers, nil
+}
+
+func hasLabel(labels map[string]string, label string) bool {
+	for key, val := range labels {
+		if key+"="+val == label {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProjectName(t *testing.T) {
+	var tests = []struct {
+		name     string
+		expected string
+	}{
+		{"shop", "shop"},
+		{"My Shop", "my-shop"},
+		{"shop_api-v2", "shop_api-v2"},
+		{"_shop.", "shop"},
+		{"", DefaultProjectName},
+		{"...", DefaultProjectName},
+	}
+
+	for i, test := range tests {
+		if got := ProjectName(test.name); got != test.expected {
+			t.Errorf("[test %d] expected %q, got %q\n", i, test.expected, got)
+		}
+	}
+}
+
+func TestProviderContainerLabels(t *testing.T) {
+	p := Provider{Labels: map[string]string{"team": "core"}}
+	p.SetProject(&Project{Name: "shop"}, "dev")
+
+	u := &fakeUnit{}
+	if got := p.containerName(u); got != "shop-fake" {
+		t.Errorf("expected container to be named shop-fake, got %q\n", got)
+	}
+
+	expected := map[string]string{
+		"team":                     "core",
+		"com.glorious.project":     "shop",
+		"com.glorious.unit":        "fake",
+		"com.glorious.slot":        "dev",
+		"com.glorious.config-hash": "abc",
+	}
+	if got := p.containerLabels(u, "abc"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected labels %v, got %v\n", expected, got)
+	}
+	if len(p.Labels) != 1 {
+		t.Error("expected the provider's labels to be left alone, got: ", p.Labels)
+	}
+
+	p.SetProject(&Project{Name: "shop"}, "")
+	delete(expected, "com.glorious.slot")
+	if got := p.containerLabels(u, "abc"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected labels without a slot %v, got %v\n", expected, got)
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	hash := func(config *container.Config) string {
+		h, err := configHash(config, &container.HostConfig{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	a := hash(&container.Config{Image: "redis:5", Env: []string{"A=1"}})
+	if b := hash(&container.Config{Image: "redis:5", Env: []string{"A=1"}}); a != b {
+		t.Error("expected the same config to have the same hash")
+	}
+	if b := hash(&container.Config{Image: "redis:6", Env: []string{"A=1"}}); a == b {
+		t.Error("expected a different image to change the hash")
+	}
+	if b := hash(&container.Config{Image: "redis:5", Env: []string{"A=2"}}); a == b {
+		t.Error("expected a different environment to change the hash")
+	}
+}
+
+func TestProviderFindContainer(t *testing.T) {
+	cli := &fakeContainerClient{
+		containers: []types.Container{
+			{ID: "other", Names: []string{"/fake"}},
+			{ID: "other-project", Labels: map[string]string{
+				"com.glorious.project": "blog",
+				"com.glorious.unit":    "fake",
+			}},
+			{ID: "ours", Labels: map[string]string{
+				"com.glorious.project": "shop",
+				"com.glorious.unit":    "fake",
+			}},
+		},
+	}
+
+	p := Provider{}
+	p.SetProject(&Project{Name: "shop"}, "dev")
+
+	c, err := p.findContainer(context.Background(), cli, &fakeUnit{})
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	} else if c == nil || c.ID != "ours" {
+		t.Fatal("expected to find our container, got: ", c)
+	}
+	if !cli.options.All {
+		t.Error("expected stopped containers to be found too")
+	}
+
+	p.SetProject(&Project{Name: "wiki"}, "dev")
+	if c, err := p.findContainer(context.Background(), cli, &fakeUnit{}); err != nil {
+		t.Fatal("unexpected error: ", err)
+	} else if c != nil {
+		t.Error("expected no container for another project, got: ", c)
+	}
+}
+
+func TestUpToDate(t *testing.T) {
+	var tests = []struct {
+		container types.Container
+		expected  bool
+	}{
+		{types.Container{State: "running", Labels: map[string]string{configHashLabel: "abc"}}, true},
+		{types.Container{State: "running", Labels: map[string]string{configHashLabel: "def"}}, false},
+		{types.Container{State: "running"}, false},
+		{types.Container{State: "exited", Labels: map[string]string{configHashLabel: "abc"}}, false},
+	}
+
+	for i, test := range tests {
+		if got := upToDate(&test.container, "abc"); got != test.expected {
+			t.Errorf("[test %d] expected %t, got %t\n", i, test.expected, got)
+		}
+	}
+}
@@ -8,59 +8,75 @@ type Provider struct {
 	Type string `hcl:"type"`
 
 	WorkingDir string `hcl:"workingDir"`
-	Cmd        string `hcl:"cmd"`
+
+	// Cmd is either a list of arguments (the exec form), or a string to
+	// be run with /bin/sh -c (the shell form).
+	Cmd interface{} `hcl:"cmd"`
 
 	Image       string   `hcl:"image"`
 	Ports       []string `hcl:"ports"`
 	Volumes     []string `hcl:"volumes"`
 	Environment []string `hcl:"environment"`
 
+	// EnvFile are dotenv files to read environment variables from, before
+	// those in Environment. Bash units inherit our environment as well,
+	// unless ClearEnvironment is set.
+	EnvFile          []string `hcl:"env_file"`
+	ClearEnvironment bool     `hcl:"clear_environment"`
+
+	// StopSignal is sent to the unit to stop it, if it is still running
+	// after StopGracePeriod it is killed.
+	StopSignal      string `hcl:"stop_signal"`
+	StopGracePeriod string `hcl:"stop_grace_period"`
+
+	// Entrypoint, User, Labels, Tmpfs, NetworkMode, ExtraHosts, Memory,
+	// CPUs, RestartPolicy and Healthcheck configure docker containers,
+	// as the `docker run` flags of the same names do. For docker units,
+	// Cmd and WorkingDir override the image's own.
+	Entrypoint    interface{}        `hcl:"entrypoint"`
+	User          string             `hcl:"user"`
+	Labels        map[string]string  `hcl:"labels"`
+	Tmpfs         []string           `hcl:"tmpfs"`
+	NetworkMode   string             `hcl:"network_mode"`
+	ExtraHosts    []string           `hcl:"extra_hosts"`
+	Memory        string             `hcl:"memory"`
+	CPUs          float64            `hcl:"cpus"`
+	RestartPolicy string             `hcl:"restart_policy"`
+	Healthcheck   *DockerHealthcheck `hcl:"healthcheck"`
+
+	// UpdatePolicy is one of notify, pull or recreate, and is what's done
+	// once the registry has a newer image for a docker unit's Image than
+	// the one it's running. Registries are checked every UpdateInterval,
+	// as long as an UpdatePolicy is set.
+	UpdatePolicy   string `hcl:"update_policy"`
+	UpdateInterval string `hcl:"update_interval"`
+
+	// Auth is the credentials to pull a docker unit's image with. Without
+	// it, docker's own config.json and credential helpers are used.
+	Auth *RegistryAuth `hcl:"auth"`
+
 	Remote   RemoteInfo    `hcl:"remote"`
 	Handlers []HandlerInfo `hcl:"handler"`
 
 	Extra map[string]interface{} `hcl:"extra"`
+
+	// configDir is the directory of the config file the provider was
+	// loaded from, see ResolvePaths.
+	configDir string
+
+	// project and slot are what the provider belongs to, see SetProject.
+	project *Project
+	slot    string
 }
 
 func (p *Provider) Validate() []error {
-	var errs []error
-	switch p.Type {
-	case "bash/remote":
-		if len(p.Remote.Host) == 0 || len(p.Remote.User) == 0 {
-			errs = append(
-				errs,
-				errors.ErrBashRemoteMissingRemote,
-			)
-		}
-		fallthrough
-	case "bash/local":
-		if len(p.Cmd) == 0 {
-			errs = append(
-				errs,
-				errors.ErrBashMissingCommand,
-			)
-		}
-		if len(p.Image) > 0 ||
-			len(p.Ports) > 0 ||
-			len(p.Volumes) > 0 ||
-			len(p.Environment) > 0 {
-			errs = append(errs, errors.ErrBashExtraneousFields)
-		}
-	case "docker/remote":
-		if len(p.Remote.Host) == 0 {
-			errs = append(errs, errors.ErrDockerRemoteMissingRemote)
-		}
-		fallthrough
-	case "docker/local":
-		if len(p.Image) == 0 {
-			errs = append(errs, errors.ErrDockerMissingImage)
-		}
-		if len(p.Cmd) > 0 || len(p.WorkingDir) > 0 {
-			errs = append(errs, errors.ErrDockerExtraneousFields)
-		}
-	default:
+	driver, ok := Lookup(p.Type)
+	if !ok && isPluginType(p.Type) {
+		return []error{errors.ErrPluginNotFound}
+	} else if !ok {
 		return []error{errors.ErrUnknownProvider}
 	}
-	return errs
+	return driver.Validate(p)
 }
 
 type RemoteInfo struct {
@@ -68,6 +84,34 @@ type RemoteInfo struct {
 	User         string `hcl:"user"`
 	IdentityFile string `hcl:"identityFile"`
 	WorkingDir   string `hcl:"workingDir"`
+
+	// Port, JumpHost and SSHOptions are only used by bash/remote, to
+	// connect to the remote host over ssh.
+	Port       int      `hcl:"port"`
+	JumpHost   string   `hcl:"jumpHost"`
+	SSHOptions []string `hcl:"sshOptions"`
+}
+
+// DockerHealthcheck is run by docker inside the container. Test is either a
+// string, run with the container's shell, or a list of arguments, which may
+// start with CMD or CMD-SHELL as in a Dockerfile's HEALTHCHECK.
+type DockerHealthcheck struct {
+	Test        interface{} `hcl:"test"`
+	Interval    string      `hcl:"interval"`
+	Timeout     string      `hcl:"timeout"`
+	StartPeriod string      `hcl:"start_period"`
+	Retries     int         `hcl:"retries"`
+
+	// Disable turns off any healthcheck the image has.
+	Disable bool `hcl:"disable"`
+}
+
+// RegistryAuth is a username and password for a docker registry. The
+// password is read from the PasswordEnv environment variable, so that it
+// needn't be kept in the config file.
+type RegistryAuth struct {
+	Username    string `hcl:"username"`
+	PasswordEnv string `hcl:"password_env"`
 }
 
 type HandlerInfo struct {
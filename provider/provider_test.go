@@ -1,9 +1,11 @@
 package provider
 
 import (
+	stderrors "errors"
 	"testing"
 
 	"github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/status"
 )
 
 func TestProviderValidate(t *testing.T) {
@@ -67,8 +69,38 @@ func TestProviderValidate(t *testing.T) {
 				Cmd:   "npm run start",
 				Image: "super/app",
 			},
+			expectedErrs: nil,
+		},
+		{
+			Provider: Provider{
+				Type:     "docker/local",
+				Image:    "super/app",
+				Handlers: []HandlerInfo{{Type: "execute/local", Cmd: "make"}},
+			},
 			expectedErrs: []error{errors.ErrDockerExtraneousFields},
 		},
+		{
+			Provider: Provider{
+				Type:          "docker/local",
+				Image:         "super/app",
+				WorkingDir:    "app",
+				Memory:        "lots",
+				RestartPolicy: "sometimes",
+			},
+			expectedErrs: []error{
+				errors.ProviderErr{ProviderType: "docker/local"},
+				errors.ProviderErr{ProviderType: "docker/local"},
+				errors.ProviderErr{ProviderType: "docker/local"},
+			},
+		},
+		{
+			Provider: Provider{
+				Type:   "bash/local",
+				Cmd:    "npm run start",
+				Memory: "512m",
+			},
+			expectedErrs: []error{errors.ErrBashExtraneousFields},
+		},
 		{
 			Provider: Provider{
 				Type:  "docker/remote",
@@ -86,3 +118,72 @@ func TestProviderValidate(t *testing.T) {
 		}
 	}
 }
+
+type fakeDriver struct {
+	errs []error
+}
+
+func (f *fakeDriver) Start(p *Provider, u Unit) error { return nil }
+func (f *fakeDriver) Stop(p *Provider, u Unit) error  { return nil }
+func (f *fakeDriver) Status(p *Provider, u Unit) (*status.Status, error) {
+	return nil, nil
+}
+func (f *fakeDriver) Logs(
+	p *Provider,
+	u Unit,
+	opts LogOptions,
+	dataChan chan []byte,
+) (func(), error) {
+	return func() {}, nil
+}
+func (f *fakeDriver) Validate(p *Provider) []error { return f.errs }
+
+func TestRegister(t *testing.T) {
+	fakeErr := stderrors.New("fake error")
+	Register("fake/test", &fakeDriver{errs: []error{fakeErr}})
+
+	if _, ok := Lookup("fake/test"); !ok {
+		t.Error("expected registered driver to be found")
+	}
+
+	p := Provider{Type: "fake/test"}
+	if errs := p.Validate(); len(errs) != 1 || errs[0] != fakeErr {
+		t.Error("expected validation to be delegated to driver, got: ", errs)
+	}
+
+	var found bool
+	for _, typ := range Types() {
+		found = found || typ == "fake/test"
+	}
+	if !found {
+		t.Error("expected registered type to be listed, got: ", Types())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected duplicate registration to panic")
+		}
+	}()
+	Register("fake/test", &fakeDriver{})
+}
+
+func TestProviderValidateStop(t *testing.T) {
+	var tests = []struct {
+		provider    Provider
+		expectedErr bool
+	}{
+		{Provider{}, false},
+		{Provider{StopSignal: "SIGINT", StopGracePeriod: "30s"}, false},
+		{Provider{StopSignal: "term"}, false},
+		{Provider{StopSignal: "SIGWHAT"}, true},
+		{Provider{StopGracePeriod: "a while"}, true},
+		{Provider{StopGracePeriod: "-1s"}, true},
+	}
+
+	for i, test := range tests {
+		errs := test.provider.validateStop()
+		if (len(errs) > 0) != test.expectedErr {
+			t.Errorf("[test %d] unexpected validation errors: %v\n", i, errs)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	gerrors "github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/remote"
+)
+
+// sshConfig returns how to connect to the remote host. Of the ssh options,
+// only those in supportedSSHOptions are understood, the rest are ignored.
+func (r RemoteInfo) sshConfig() remote.Config {
+	conf := remote.Config{
+		Host:         r.Host,
+		Port:         r.Port,
+		User:         r.User,
+		IdentityFile: expandHomeOrKeep(r.IdentityFile),
+		JumpHost:     r.JumpHost,
+	}
+
+	for _, opt := range r.SSHOptions {
+		key, value := splitSSHOption(opt)
+		switch strings.ToLower(key) {
+		case "stricthostkeychecking":
+			conf.InsecureIgnoreHostKey = strings.ToLower(value) == "no"
+		case "userknownhostsfile":
+			conf.KnownHostsFile = expandHomeOrKeep(value)
+		case "connecttimeout":
+			if secs, err := strconv.Atoi(value); err == nil {
+				conf.Timeout = time.Duration(secs) * time.Second
+			}
+		case "identityfile":
+			if len(r.IdentityFile) == 0 {
+				conf.IdentityFile = expandHomeOrKeep(value)
+			}
+		case "serveraliveinterval":
+			if secs, err := strconv.Atoi(value); err == nil {
+				conf.KeepAlive = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return conf
+}
+
+// supportedSSHOptions are the ssh options that are understood, lower cased.
+var supportedSSHOptions = map[string]bool{
+	"stricthostkeychecking": true,
+	"userknownhostsfile":    true,
+	"connecttimeout":        true,
+	"identityfile":          true,
+	"serveraliveinterval":   true,
+}
+
+// unsupportedSSHOptions returns the ssh options that are ignored when
+// connecting to the remote host.
+func (r RemoteInfo) unsupportedSSHOptions() []string {
+	var opts []string
+	for _, opt := range r.SSHOptions {
+		if key, _ := splitSSHOption(opt); !supportedSSHOptions[strings.ToLower(key)] {
+			opts = append(opts, opt)
+		}
+	}
+	return opts
+}
+
+// splitSSHOption splits an option given as either Key=Value or Key Value.
+func splitSSHOption(opt string) (string, string) {
+	i := strings.IndexAny(opt, "= ")
+	if i < 0 {
+		return opt, ""
+	}
+	return strings.TrimSpace(opt[:i]), strings.TrimSpace(opt[i+1:])
+}
+
+// sshClient returns the client for the remote host, which is shared by
+// everything that connects to it in the same way.
+func (p *Provider) sshClient() *remote.Client {
+	return remote.Get(p.Remote.sshConfig())
+}
+
+// expandHomeOrKeep is expandHome for paths that are checked when the config
+// is validated.
+func expandHomeOrKeep(path string) string {
+	if expanded, err := expandHome(path); err == nil {
+		return expanded
+	}
+	return path
+}
+
+// validateSSH checks the options used to connect to the remote host.
+func (r RemoteInfo) validateSSH() []error {
+	var errs []error
+	if len(r.IdentityFile) > 0 {
+		identityFile, err := expandHome(r.IdentityFile)
+		if err == nil {
+			_, err = os.Stat(identityFile)
+		}
+		if err != nil {
+			errs = append(errs, gerrors.ErrBashRemoteMissingIdentityFile)
+		}
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		errs = append(errs, gerrors.ErrBashRemoteInvalidPort)
+	}
+	for _, opt := range r.SSHOptions {
+		key, value := splitSSHOption(opt)
+		switch strings.ToLower(key) {
+		case "connecttimeout", "serveraliveinterval":
+			if secs, err := strconv.Atoi(value); err != nil || secs < 0 {
+				errs = append(errs, gerrors.ErrBashRemoteInvalidSSHOption)
+			}
+		case "identityfile":
+			if len(value) == 0 {
+				errs = append(errs, gerrors.ErrBashRemoteInvalidSSHOption)
+			} else if len(r.IdentityFile) == 0 {
+				identityFile, err := expandHome(value)
+				if err == nil {
+					_, err = os.Stat(identityFile)
+				}
+				if err != nil {
+					errs = append(errs, gerrors.ErrBashRemoteMissingIdentityFile)
+				}
+			}
+		}
+	}
+	return errs
+}
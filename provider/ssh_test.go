@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/remote"
+)
+
+func TestRemoteInfoSSHConfig(t *testing.T) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		remote   RemoteInfo
+		expected remote.Config
+	}{
+		{
+			RemoteInfo{Host: "dev.box", User: "user"},
+			remote.Config{Host: "dev.box", User: "user"},
+		},
+		{
+			RemoteInfo{Host: "dev.box", IdentityFile: "~/.ssh/dev.pem", Port: 2222},
+			remote.Config{
+				Host:         "dev.box",
+				IdentityFile: filepath.Join(homeDir, ".ssh", "dev.pem"),
+				Port:         2222,
+			},
+		},
+		{
+			RemoteInfo{
+				Host:     "dev.box",
+				JumpHost: "user@bastion:22",
+				SSHOptions: []string{
+					"StrictHostKeyChecking=no",
+					"UserKnownHostsFile /keys/known_hosts",
+					"connecttimeout=5",
+				},
+			},
+			remote.Config{
+				Host:                  "dev.box",
+				JumpHost:              "user@bastion:22",
+				InsecureIgnoreHostKey: true,
+				KnownHostsFile:        "/keys/known_hosts",
+				Timeout:               5 * time.Second,
+			},
+		},
+		{
+			RemoteInfo{
+				Host: "dev.box",
+				SSHOptions: []string{
+					"IdentityFile=~/.ssh/dev.pem",
+					"ServerAliveInterval=30",
+					"ForwardAgent=yes",
+				},
+			},
+			remote.Config{
+				Host:         "dev.box",
+				IdentityFile: filepath.Join(homeDir, ".ssh", "dev.pem"),
+				KeepAlive:    30 * time.Second,
+			},
+		},
+		// The identityFile field wins over the option.
+		{
+			RemoteInfo{
+				Host:         "dev.box",
+				IdentityFile: "/keys/dev.pem",
+				SSHOptions:   []string{"IdentityFile=/keys/other.pem"},
+			},
+			remote.Config{Host: "dev.box", IdentityFile: "/keys/dev.pem"},
+		},
+	}
+
+	for i, test := range tests {
+		if got := test.remote.sshConfig(); got != test.expected {
+			t.Errorf("[test %d] expected %+v, got %+v\n", i, test.expected, got)
+		}
+	}
+}
+
+func TestRemoteInfoUnsupportedSSHOptions(t *testing.T) {
+	r := RemoteInfo{SSHOptions: []string{
+		"ConnectTimeout=5",
+		"ForwardAgent=yes",
+		"serveraliveinterval 10",
+		"Compression yes",
+	}}
+
+	expected := []string{"ForwardAgent=yes", "Compression yes"}
+	if got := r.unsupportedSSHOptions(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v\n", expected, got)
+	}
+}
+
+func TestRemoteInfoValidateSSH(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(keyFile, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		remote       RemoteInfo
+		expectedErrs []error
+	}{
+		{RemoteInfo{}, nil},
+		{RemoteInfo{IdentityFile: keyFile, Port: 22}, nil},
+		{
+			RemoteInfo{IdentityFile: filepath.Join(dir, "missing.pem")},
+			[]error{errors.ErrBashRemoteMissingIdentityFile},
+		},
+		{
+			RemoteInfo{Port: 70000},
+			[]error{errors.ErrBashRemoteInvalidPort},
+		},
+		{
+			RemoteInfo{SSHOptions: []string{"StrictHostKeyChecking=no", "ConnectTimeout=10"}},
+			nil,
+		},
+		{
+			RemoteInfo{SSHOptions: []string{
+				"IdentityFile=" + keyFile,
+				"ServerAliveInterval 30",
+				"ForwardAgent=yes",
+			}},
+			nil,
+		},
+		{
+			RemoteInfo{SSHOptions: []string{
+				"ConnectTimeout=soon",
+				"ServerAliveInterval=-1",
+				"IdentityFile=" + filepath.Join(dir, "missing.pem"),
+			}},
+			[]error{
+				errors.ErrBashRemoteInvalidSSHOption,
+				errors.ErrBashRemoteInvalidSSHOption,
+				errors.ErrBashRemoteMissingIdentityFile,
+			},
+		},
+	}
+
+	for i, test := range tests {
+		errs := test.remote.validateSSH()
+		if !reflect.DeepEqual(errs, test.expectedErrs) {
+			t.Errorf("[test %d] expected %v, got %v\n", i, test.expectedErrs, errs)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultStopGracePeriod = 10 * time.Second
+
+// stopPollInterval is how often we check whether a stopped process has
+// exited yet.
+var stopPollInterval = 100 * time.Millisecond
+
+var stopSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// signalName normalizes a signal name, so that SIGTERM, sigterm and TERM
+// are all TERM.
+func signalName(name string) string {
+	return strings.TrimPrefix(strings.ToUpper(name), "SIG")
+}
+
+func (p *Provider) stopSignalName() string {
+	if len(p.StopSignal) == 0 {
+		return "TERM"
+	}
+	return signalName(p.StopSignal)
+}
+
+func (p *Provider) stopSignal() (syscall.Signal, error) {
+	sig, ok := stopSignals[p.stopSignalName()]
+	if !ok {
+		return 0, fmt.Errorf("unsupported stop_signal %q", p.StopSignal)
+	}
+	return sig, nil
+}
+
+func (p *Provider) stopGracePeriod() (time.Duration, error) {
+	if len(p.StopGracePeriod) == 0 {
+		return defaultStopGracePeriod, nil
+	}
+
+	grace, err := time.ParseDuration(p.StopGracePeriod)
+	if err != nil {
+		return 0, fmt.Errorf("invalid stop_grace_period: %s", err)
+	} else if grace < 0 {
+		return 0, fmt.Errorf("stop_grace_period cannot be negative")
+	}
+	return grace, nil
+}
+
+// validateStop checks the stop_signal and stop_grace_period fields.
+func (p *Provider) validateStop() []error {
+	var errs []error
+	if _, err := p.stopSignal(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := p.stopGracePeriod(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
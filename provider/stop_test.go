@@ -0,0 +1,86 @@
+//go:build !windows
+// +build !windows
+
+package provider
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startGroup starts a shell script in its own process group, reaping it in
+// the background.
+func startGroup(t *testing.T, script string) *exec.Cmd {
+	c := exec.Command("/bin/sh", "-c", script)
+	setProcessGroup(c)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go c.Wait()
+
+	// Give the shell a chance to start its children.
+	time.Sleep(100 * time.Millisecond)
+	return c
+}
+
+// groupRunning returns whether anything in the process group is still
+// running. Zombies don't count, as there's no guarantee that whatever
+// inherited them has reaped them yet.
+func groupRunning(t *testing.T, pgid int) bool {
+	out, err := exec.Command("ps", "-eo", "pgid=,stat=").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 &&
+			fields[0] == strconv.Itoa(pgid) &&
+			!strings.HasPrefix(fields[1], "Z") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTerminate(t *testing.T) {
+	var tests = []struct {
+		script  string
+		grace   time.Duration
+		minTime time.Duration
+	}{
+		// Both sleeps should go, not just the shell.
+		{"sleep 30 & sleep 30", time.Second, 0},
+		// TERM is ignored, so we should have to wait out the grace
+		// period before it's killed.
+		{`trap "" TERM; sleep 30 & while true; do sleep 0.1; done`, 300 * time.Millisecond, 300 * time.Millisecond},
+	}
+
+	for i, test := range tests {
+		c := startGroup(t, test.script)
+
+		start := time.Now()
+		if err := terminate(c.Process.Pid, syscall.SIGTERM, test.grace); err != nil {
+			t.Errorf("[test %d] failed to terminate: %s\n", i, err)
+		}
+		elapsed := time.Since(start)
+
+		if elapsed < test.minTime || elapsed > test.grace+time.Second {
+			t.Errorf("[test %d] unexpected time to terminate: %s\n", i, elapsed)
+		}
+
+		// Wait for the shell to be reaped.
+		deadline := time.Now().Add(time.Second)
+		for groupRunning(t, c.Process.Pid) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if groupRunning(t, c.Process.Pid) {
+			t.Errorf("[test %d] expected process group to be gone\n", i)
+			_ = syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+		}
+	}
+}
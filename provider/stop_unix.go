@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package provider
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup puts the command in its own process group, so that it and
+// everything it starts can be stopped together.
+func setProcessGroup(c *exec.Cmd) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.SysProcAttr.Setpgid = true
+}
+
+// terminate sends sig to the process, and to its process group if it leads
+// one, then kills them if they're still running after the grace period.
+func terminate(pid int, sig syscall.Signal, grace time.Duration) error {
+	target := pid
+	if pgid, err := syscall.Getpgid(pid); err == nil && pgid == pid {
+		target = -pid
+	}
+
+	if err := syscall.Kill(target, sig); err == syscall.ESRCH {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		if syscall.Kill(target, 0) == syscall.ESRCH {
+			return nil
+		}
+		time.Sleep(stopPollInterval)
+	}
+
+	if err := syscall.Kill(target, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package provider
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Process groups and signals aren't supported on Windows, so processes are
+// simply killed.
+func setProcessGroup(c *exec.Cmd) {}
+
+func terminate(pid int, sig syscall.Signal, grace time.Duration) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+	return proc.Kill()
+}
@@ -0,0 +1,113 @@
+package remote
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultIdentityFiles are tried, relative to ~/.ssh, when no identity file
+// is given.
+var defaultIdentityFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// authMethods returns how to log in to the remote host. The returned func
+// closes the connection to the ssh agent, if one was made, and must be
+// called once the connection has been made.
+func (conf Config) authMethods() ([]ssh.AuthMethod, func(), error) {
+	signers, err := conf.identitySigners()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		agentClient agent.Agent
+		closeAgent  = func() {}
+	)
+	if sock := os.Getenv("SSH_AUTH_SOCK"); len(sock) > 0 {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentClient = agent.NewClient(conn)
+			closeAgent = func() { conn.Close() }
+		}
+	}
+
+	// All the keys have to be offered by a single method, as only the
+	// first method of each type is ever tried.
+	return []ssh.AuthMethod{
+		ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			if agentClient == nil {
+				return signers, nil
+			}
+			agentSigners, err := agentClient.Signers()
+			if err != nil {
+				return signers, nil
+			}
+			return append(signers, agentSigners...), nil
+		}),
+	}, closeAgent, nil
+}
+
+func (conf Config) identitySigners() ([]ssh.Signer, error) {
+	if len(conf.IdentityFile) > 0 {
+		signer, err := readIdentityFile(conf.IdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.Signer{signer}, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil
+	}
+
+	var signers []ssh.Signer
+	for _, name := range defaultIdentityFiles {
+		// Default keys that can't be used, say because they need a
+		// passphrase, are skipped in favour of the agent.
+		signer, err := readIdentityFile(filepath.Join(homeDir, ".ssh", name))
+		if err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	return signers, nil
+}
+
+func readIdentityFile(path string) (ssh.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity file %s: %s", path, err)
+	}
+	return signer, nil
+}
+
+func (conf Config) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if conf.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	knownHostsFile := conf.KnownHostsFile
+	if len(knownHostsFile) == 0 {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHostsFile = filepath.Join(homeDir, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts: %s", err)
+	}
+	return callback, nil
+}
@@ -0,0 +1,360 @@
+// Package remote runs commands on, and copies files to, remote hosts over
+// SSH, without depending on the ssh and rsync binaries.
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultPort    = 22
+	defaultTimeout = 10 * time.Second
+
+	// keepAliveCountMax is how many keepalives in a row may go unanswered
+	// before the connection is given up on, as with ssh's
+	// ServerAliveCountMax.
+	keepAliveCountMax = 3
+)
+
+// Config describes how to connect to a remote host.
+type Config struct {
+	Host string
+	Port int
+	User string
+
+	// IdentityFile is the private key to log in with. If it isn't set,
+	// the user's default keys are tried. Keys held by the ssh agent are
+	// always tried.
+	IdentityFile string
+
+	// JumpHost is a host, in the form [user@]host[:port], to connect to
+	// the remote host through.
+	JumpHost string
+
+	// KnownHostsFile is checked for the remote host's key, it defaults
+	// to ~/.ssh/known_hosts.
+	KnownHostsFile        string
+	InsecureIgnoreHostKey bool
+
+	Timeout time.Duration
+
+	// KeepAlive is how often to check that the remote host is still
+	// there when the connection is otherwise idle, as with ssh's
+	// ServerAliveInterval. Zero means never.
+	KeepAlive time.Duration
+}
+
+func (conf Config) addr() string {
+	port := conf.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	return net.JoinHostPort(conf.Host, strconv.Itoa(port))
+}
+
+// jumpConfig returns the config for connecting to the jump host, which is
+// logged in to with the same keys as the remote host.
+func (conf Config) jumpConfig() (Config, error) {
+	jump := conf
+	jump.JumpHost = ""
+	jump.Port = 0
+
+	host := conf.JumpHost
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		jump.User = host[:i]
+		host = host[i+1:]
+	}
+
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return jump, fmt.Errorf("invalid jump host port %q", port)
+		}
+		host, jump.Port = h, p
+	}
+	jump.Host = host
+	return jump, nil
+}
+
+func (conf Config) clientConfig() (*ssh.ClientConfig, func(), error) {
+	auth, closeAgent, err := conf.authMethods()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostKeyCallback, err := conf.hostKeyCallback()
+	if err != nil {
+		closeAgent()
+		return nil, nil, err
+	}
+
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	return &ssh.ClientConfig{
+		User:            conf.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	}, closeAgent, nil
+}
+
+// dial connects to the remote host, through the jump host if there is one.
+func dial(conf Config) (client, jump *ssh.Client, err error) {
+	clientConf, closeAgent, err := conf.clientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeAgent()
+
+	if len(conf.JumpHost) == 0 {
+		client, err := ssh.Dial("tcp", conf.addr(), clientConf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to %s: %s", conf.addr(), err)
+		}
+		return client, nil, nil
+	}
+
+	jumpConf, err := conf.jumpConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	jumpClientConf, closeJumpAgent, err := jumpConf.clientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeJumpAgent()
+
+	jump, err = ssh.Dial("tcp", jumpConf.addr(), jumpClientConf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to jump host %s: %s", jumpConf.addr(), err)
+	}
+
+	conn, err := jump.Dial("tcp", conf.addr())
+	if err != nil {
+		jump.Close()
+		return nil, nil, fmt.Errorf("failed to reach %s from jump host: %s", conf.addr(), err)
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, conf.addr(), clientConf)
+	if err != nil {
+		conn.Close()
+		jump.Close()
+		return nil, nil, fmt.Errorf("failed to connect to %s: %s", conf.addr(), err)
+	}
+	return ssh.NewClient(c, chans, reqs), jump, nil
+}
+
+// Client is a connection to a remote host, which is made when it's first
+// needed and remade if it is lost.
+type Client struct {
+	conf Config
+
+	mux    sync.Mutex
+	client *ssh.Client
+	jump   *ssh.Client
+}
+
+var (
+	clientsMux sync.Mutex
+	clients    = make(map[Config]*Client)
+)
+
+// Get returns the client for conf, which is shared with everything else
+// that connects to the same host in the same way.
+func Get(conf Config) *Client {
+	clientsMux.Lock()
+	defer clientsMux.Unlock()
+
+	c, ok := clients[conf]
+	if !ok {
+		c = &Client{conf: conf}
+		clients[conf] = c
+	}
+	return c
+}
+
+func (c *Client) connect() (*ssh.Client, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.client != nil {
+		return c.client, nil
+	}
+
+	client, jump, err := dial(c.conf)
+	if err != nil {
+		return nil, err
+	}
+	c.client, c.jump = client, jump
+
+	// Forget the connection once it's gone, so that the next session
+	// makes a new one.
+	done := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(done)
+		c.disconnect(client)
+	}()
+	if c.conf.KeepAlive > 0 {
+		go keepAlive(client, c.conf.KeepAlive, done)
+	}
+	return client, nil
+}
+
+// keepAlive sends a keepalive request over client every interval until done
+// is closed, and closes client once too many of them go unanswered.
+func keepAlive(client *ssh.Client, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		replied := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			replied <- err
+		}()
+
+		select {
+		case <-done:
+			return
+		case err := <-replied:
+			if err != nil {
+				client.Close()
+				return
+			}
+			missed = 0
+		case <-time.After(interval):
+			if missed++; missed >= keepAliveCountMax {
+				client.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) disconnect(client *ssh.Client) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.client != client {
+		return
+	}
+	c.client.Close()
+	if c.jump != nil {
+		c.jump.Close()
+	}
+	c.client, c.jump = nil, nil
+}
+
+// NewSession opens a new session on the remote host, for running a single
+// command.
+func (c *Client) NewSession() (*ssh.Session, error) {
+	client, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := client.NewSession()
+	if err == nil {
+		return sess, nil
+	}
+
+	// The connection may have died without us noticing yet, so give it
+	// one more go on a new one.
+	c.disconnect(client)
+	if client, err = c.connect(); err != nil {
+		return nil, err
+	}
+	return client.NewSession()
+}
+
+// Run runs script with the remote user's shell, and waits for it to exit.
+func (c *Client) Run(script string, stdin io.Reader, stdout, stderr io.Writer) error {
+	sess, err := c.NewSession()
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	sess.Stdin = stdin
+	sess.Stdout = stdout
+	sess.Stderr = stderr
+	return sess.Run(script)
+}
+
+// Output runs script and returns its standard output.
+func (c *Client) Output(script string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	if err := c.Run(script, nil, &stdout, &stderr); err != nil {
+		return stdout.Bytes(), commandError(err, stderr.Bytes())
+	}
+	return stdout.Bytes(), nil
+}
+
+// CombinedOutput runs script and returns its standard output and standard
+// error.
+func (c *Client) CombinedOutput(script string) ([]byte, error) {
+	sess, err := c.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+
+	return sess.CombinedOutput(script)
+}
+
+func commandError(err error, stderr []byte) error {
+	stderr = bytes.TrimSpace(stderr)
+	if len(stderr) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s: %s", err, stderr)
+}
+
+// Close closes the client's connection, a new one is made if it's used
+// again.
+func (c *Client) Close() error {
+	c.mux.Lock()
+	client := c.client
+	c.mux.Unlock()
+
+	if client != nil {
+		c.disconnect(client)
+	}
+	return nil
+}
+
+// Quote quotes s for use as a single word in a remote shell script.
+func Quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// QuotePath quotes path like Quote, except that a leading ~ still refers to
+// the remote user's home directory.
+func QuotePath(path string) string {
+	if path == "~" {
+		return `"$HOME"`
+	} else if strings.HasPrefix(path, "~/") {
+		return `"$HOME"/` + Quote(path[2:])
+	}
+	return Quote(path)
+}
@@ -0,0 +1,232 @@
+//go:build !windows
+// +build !windows
+
+package remote
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ttacon/glorious/remote/remotetest"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer starts a server with a temporary home directory, and returns a
+// config that can connect to it.
+func testServer(t *testing.T) (*remotetest.Server, Config, func()) {
+	dir, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	home := filepath.Join(dir, "home")
+	if err := os.Mkdir(home, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := remotetest.NewServer(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := Config{
+		Host:           srv.Host(),
+		Port:           srv.Port(),
+		User:           "glorious",
+		IdentityFile:   filepath.Join(dir, "id_ecdsa"),
+		KnownHostsFile: filepath.Join(dir, "known_hosts"),
+	}
+	if err := srv.WriteClientKey(conf.IdentityFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddToKnownHosts(conf.KnownHostsFile); err != nil {
+		t.Fatal(err)
+	}
+
+	return srv, conf, func() {
+		Get(conf).Close()
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestClientRun(t *testing.T) {
+	srv, conf, cleanup := testServer(t)
+	defer cleanup()
+
+	c := Get(conf)
+
+	out, err := c.Output("echo $HOME")
+	if err != nil {
+		t.Fatal(err)
+	} else if got := strings.TrimSpace(string(out)); got != srv.Home {
+		t.Errorf("expected %q, got %q\n", srv.Home, got)
+	}
+
+	out, err = c.CombinedOutput("echo oops >&2; exit 3")
+	if exitErr, ok := err.(*ssh.ExitError); !ok || exitErr.ExitStatus() != 3 {
+		t.Error("expected exit status 3, got: ", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "oops" {
+		t.Errorf("expected %q, got %q\n", "oops", got)
+	}
+
+	if _, err := c.Output("echo oops >&2; false"); err == nil ||
+		!strings.Contains(err.Error(), "oops") {
+		t.Error("expected error to include stderr, got: ", err)
+	}
+
+	// Every command should have gone over the same connection.
+	if n := srv.Connections(); n != 1 {
+		t.Errorf("expected 1 connection, got %d\n", n)
+	}
+
+	// Losing the connection should just mean making another one.
+	c.Close()
+	if _, err := Get(conf).Output("true"); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Connections(); n != 2 {
+		t.Errorf("expected 2 connections, got %d\n", n)
+	}
+}
+
+func TestClientKeepAlive(t *testing.T) {
+	srv, conf, cleanup := testServer(t)
+	defer cleanup()
+
+	conf.KeepAlive = 10 * time.Millisecond
+	defer Get(conf).Close()
+
+	if _, err := Get(conf).Output("true"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A host that answers its keepalives keeps its connection.
+	time.Sleep(100 * time.Millisecond)
+	if _, err := Get(conf).Output("true"); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Connections(); n != 1 {
+		t.Errorf("expected 1 connection, got %d\n", n)
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	srv, conf, cleanup := testServer(t)
+	defer cleanup()
+
+	other, otherConf, otherCleanup := testServer(t)
+	defer otherCleanup()
+
+	var tests = []struct {
+		conf     Config
+		expected string
+	}{
+		// Another server's key isn't authorized.
+		{
+			Config{
+				Host:           srv.Host(),
+				Port:           srv.Port(),
+				IdentityFile:   otherConf.IdentityFile,
+				KnownHostsFile: conf.KnownHostsFile,
+			},
+			"unable to authenticate",
+		},
+		// Nor is another server's host key known.
+		{
+			Config{
+				Host:           srv.Host(),
+				Port:           srv.Port(),
+				IdentityFile:   conf.IdentityFile,
+				KnownHostsFile: otherConf.KnownHostsFile,
+			},
+			"knownhosts: key is unknown",
+		},
+		{
+			Config{
+				Host:           srv.Host(),
+				Port:           srv.Port(),
+				IdentityFile:   filepath.Join(srv.Home, "missing"),
+				KnownHostsFile: conf.KnownHostsFile,
+			},
+			"no such file",
+		},
+	}
+
+	for i, test := range tests {
+		_, err := Get(test.conf).Output("true")
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("[test %d] expected %q error, got: %v\n", i, test.expected, err)
+		}
+	}
+
+	// Unless we don't care about host keys.
+	insecure := tests[1].conf
+	insecure.InsecureIgnoreHostKey = true
+	if _, err := Get(insecure).Output("true"); err != nil {
+		t.Error("unexpected error: ", err)
+	}
+	Get(insecure).Close()
+
+	if other.Connections() != 0 {
+		t.Error("unexpected connection to other server")
+	}
+}
+
+func TestClientJumpHost(t *testing.T) {
+	srv, conf, cleanup := testServer(t)
+	defer cleanup()
+
+	jump, jumpConf, jumpCleanup := testServer(t)
+	defer jumpCleanup()
+
+	jump.Authorize(srv.ClientPublicKey())
+	if err := jump.AddToKnownHosts(conf.KnownHostsFile); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.JumpHost = "jumper@" + jump.Addr
+	defer Get(conf).Close()
+
+	out, err := Get(conf).Output("echo $HOME")
+	if err != nil {
+		t.Fatal(err)
+	} else if got := strings.TrimSpace(string(out)); got != srv.Home {
+		t.Errorf("expected %q, got %q\n", srv.Home, got)
+	}
+	if jump.Connections() != 1 || srv.Connections() != 1 {
+		t.Errorf(
+			"expected one connection to each server, got %d and %d\n",
+			jump.Connections(),
+			srv.Connections(),
+		)
+	}
+
+	jumpConf.JumpHost = "jumper@" + jump.Host() + ":notaport"
+	if _, err := Get(jumpConf).Output("true"); err == nil {
+		t.Error("expected invalid jump host port to fail")
+	}
+}
+
+func TestQuotePath(t *testing.T) {
+	var tests = []struct {
+		path     string
+		expected string
+	}{
+		{"/srv/app", `'/srv/app'`},
+		{"~", `"$HOME"`},
+		{"~/code/it's", `"$HOME"/'code/it'\''s'`},
+		{"~other/code", `'~other/code'`},
+	}
+
+	for i, test := range tests {
+		if got := QuotePath(test.path); got != test.expected {
+			t.Errorf("[test %d] expected %s, got %s\n", i, test.expected, got)
+		}
+	}
+}
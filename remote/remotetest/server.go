@@ -0,0 +1,328 @@
+// Package remotetest provides an in-process SSH server for testing code that
+// runs things on remote hosts.
+package remotetest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Server is an SSH server that runs commands with /bin/sh, with Home as the
+// home directory. Only the client key it generates, and any others it is told
+// to Authorize, can log in to it. It also forwards connections, so that it
+// can be used as a jump host.
+type Server struct {
+	Addr string
+	Home string
+
+	hostKey   ssh.Signer
+	clientKey *ecdsa.PrivateKey
+	listener  net.Listener
+	conns     int32
+	wg        sync.WaitGroup
+
+	activeMux sync.Mutex
+	active    map[net.Conn]bool
+
+	authorizedMux sync.Mutex
+	authorized    []ssh.PublicKey
+}
+
+// NewServer starts a server listening on a local port.
+func NewServer(home string) (*Server, error) {
+	hostKey, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		return nil, err
+	}
+	clientKey, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	clientPub, err := ssh.NewPublicKey(&clientKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Addr:      l.Addr().String(),
+		Home:      home,
+		hostKey:   hostSigner,
+		clientKey: clientKey,
+		listener:  l,
+		active:    make(map[net.Conn]bool),
+
+		authorized: []ssh.PublicKey{clientPub},
+	}
+	go s.serve()
+	return s, nil
+}
+
+func newKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// Host returns the host the server is listening on.
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	return host
+}
+
+// Port returns the port the server is listening on.
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// Connections returns how many connections have been made to the server.
+func (s *Server) Connections() int {
+	return int(atomic.LoadInt32(&s.conns))
+}
+
+// WriteClientKey writes the private key that can log in to the server to
+// path.
+func (s *Server) WriteClientKey(path string) error {
+	der, err := x509.MarshalECPrivateKey(s.clientKey)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(
+		path,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}),
+		0600,
+	)
+}
+
+// ClientPublicKey returns the public half of the key written by
+// WriteClientKey.
+func (s *Server) ClientPublicKey() ssh.PublicKey {
+	return s.authorized[0]
+}
+
+// Authorize lets key log in to the server as well.
+func (s *Server) Authorize(key ssh.PublicKey) {
+	s.authorizedMux.Lock()
+	s.authorized = append(s.authorized, key)
+	s.authorizedMux.Unlock()
+}
+
+func (s *Server) isAuthorized(key ssh.PublicKey) bool {
+	s.authorizedMux.Lock()
+	defer s.authorizedMux.Unlock()
+
+	for _, authorized := range s.authorized {
+		if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddToKnownHosts adds the server's key to the known hosts file at path.
+func (s *Server) AddToKnownHosts(path string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(knownhosts.Line([]string{s.Addr}, s.hostKey.PublicKey()) + "\n")
+	return err
+}
+
+// Close stops the server, dropping any connections to it, and waits for the
+// commands it is running to exit.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.activeMux.Lock()
+	for conn := range s.active {
+		conn.Close()
+	}
+	s.activeMux.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	conf := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !s.isAuthorized(key) {
+				return nil, errors.New("unknown public key")
+			}
+			return nil, nil
+		},
+	}
+	conf.AddHostKey(s.hostKey)
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&s.conns, 1)
+
+		s.activeMux.Lock()
+		s.active[conn] = true
+		s.activeMux.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn, conf)
+
+			s.activeMux.Lock()
+			delete(s.active, conn)
+			s.activeMux.Unlock()
+		}()
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn, conf *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, conf)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		switch newChan.ChannelType() {
+		case "session":
+			s.wg.Add(1)
+			go func(newChan ssh.NewChannel) {
+				defer s.wg.Done()
+				s.handleSession(newChan)
+			}(newChan)
+		case "direct-tcpip":
+			go handleForward(newChan)
+		default:
+			newChan.Reject(ssh.UnknownChannelType, "unknown channel type")
+		}
+	}
+}
+
+func (s *Server) handleSession(newChan ssh.NewChannel) {
+	channel, reqs, err := newChan.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	var (
+		cmd  *exec.Cmd
+		done = make(chan struct{})
+	)
+	for req := range reqs {
+		if req.Type != "exec" || cmd != nil {
+			req.Reply(false, nil)
+			continue
+		}
+
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+
+		cmd = exec.Command("/bin/sh", "-c", payload.Command)
+		cmd.Dir = s.Home
+		cmd.Env = append(os.Environ(), "HOME="+s.Home)
+		cmd.Stdin = channel
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+		if err := cmd.Start(); err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+
+		go func() {
+			defer close(done)
+
+			status := 0
+			if err := cmd.Wait(); err != nil {
+				status = 255
+				if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() >= 0 {
+					status = exitErr.ExitCode()
+				}
+			}
+			channel.SendRequest(
+				"exit-status",
+				false,
+				ssh.Marshal(struct{ Status uint32 }{uint32(status)}),
+			)
+			channel.Close()
+		}()
+	}
+
+	// The client has gone, so take the command with it.
+	if cmd != nil {
+		cmd.Process.Kill()
+		<-done
+	}
+}
+
+func handleForward(newChan ssh.NewChannel) {
+	var payload struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := ssh.Unmarshal(newChan.ExtraData(), &payload); err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	conn, err := net.Dial(
+		"tcp",
+		net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))),
+	)
+	if err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	channel, reqs, err := newChan.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(reqs)
+
+	go func() {
+		io.Copy(conn, channel)
+		conn.Close()
+	}()
+	io.Copy(channel, conn)
+}
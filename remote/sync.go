@@ -0,0 +1,208 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// syncFile is a file to be synced to the remote host.
+type syncFile struct {
+	local string // its path on this machine
+	name  string // its path on the remote host, relative to the root
+	mode  os.FileMode
+	sum   string
+}
+
+// Sync copies local, a file or a directory, to dest on the remote host. Only
+// regular files whose contents differ from the remote copy are sent, and
+// files and directories whose names match one of the exclude patterns are
+// skipped. The names of the files that were sent are returned.
+func (c *Client) Sync(local, dest string, exclude []string) ([]string, error) {
+	info, err := os.Stat(local)
+	if err != nil {
+		return nil, err
+	}
+
+	root, files := dest, []*syncFile{}
+	if info.IsDir() {
+		files, err = localFiles(local, exclude)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		root = path.Dir(dest)
+		files = append(files, &syncFile{
+			local: local,
+			name:  path.Base(dest),
+			mode:  info.Mode(),
+		})
+	}
+
+	for _, f := range files {
+		if f.sum, err = checksum(f.local); err != nil {
+			return nil, err
+		}
+	}
+
+	remoteSums, err := c.remoteChecksums(root, info.IsDir(), files, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var sent []string
+	for _, f := range files {
+		if remoteSums[f.name] == f.sum {
+			continue
+		}
+		if err := c.send(root, f); err != nil {
+			return sent, err
+		}
+		sent = append(sent, f.name)
+	}
+	return sent, nil
+}
+
+func localFiles(dir string, exclude []string) ([]*syncFile, error) {
+	var files []*syncFile
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && excluded(info.Name(), exclude) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, &syncFile{
+			local: p,
+			name:  filepath.ToSlash(rel),
+			mode:  info.Mode(),
+		})
+		return nil
+	})
+	return files, err
+}
+
+func excluded(name string, exclude []string) bool {
+	for _, pattern := range exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func checksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remoteChecksums returns the checksums of the files under root on the
+// remote host, keyed by their path relative to root. For directories every
+// file is checked, otherwise only the given files are.
+func (c *Client) remoteChecksums(
+	root string,
+	isDir bool,
+	files []*syncFile,
+	exclude []string,
+) (map[string]string, error) {
+	var targets string
+	if isDir {
+		var prune []string
+		for _, pattern := range exclude {
+			prune = append(prune, "-name "+Quote(pattern))
+		}
+		if len(prune) > 0 {
+			targets = `find . \( ` + strings.Join(prune, " -o ") + ` \) -prune -o -type f -exec $sum {} +`
+		} else {
+			targets = "find . -type f -exec $sum {} +"
+		}
+	} else {
+		var names []string
+		for _, f := range files {
+			names = append(names, Quote("./"+f.name))
+		}
+		targets = "$sum " + strings.Join(names, " ")
+	}
+
+	// Missing files and directories just mean that there's more to send.
+	script := fmt.Sprintf(`cd %s 2>/dev/null || exit 0
+sum=sha256sum
+command -v sha256sum >/dev/null 2>&1 || sum="shasum -a 256"
+%s 2>/dev/null
+exit 0`,
+		QuotePath(root),
+		targets,
+	)
+
+	out, err := c.Output(script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check remote files: %s", err)
+	}
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// Each line is the checksum, then two spaces and the file name.
+		fields := strings.SplitN(scanner.Text(), "  ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		sums[strings.TrimPrefix(fields[1], "./")] = fields[0]
+	}
+	return sums, scanner.Err()
+}
+
+func (c *Client) send(root string, f *syncFile) error {
+	file, err := os.Open(f.local)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Write to a temporary file first, so that nothing sees it half
+	// written.
+	dest := QuotePath(path.Join(root, f.name))
+	tmp := QuotePath(path.Join(root, path.Dir(f.name), ".glorious-"+path.Base(f.name)))
+	script := fmt.Sprintf(
+		"mkdir -p %s && cat > %s && chmod %o %s && mv -f %s %s",
+		QuotePath(path.Join(root, path.Dir(f.name))),
+		tmp,
+		f.mode.Perm(),
+		tmp,
+		tmp,
+		dest,
+	)
+
+	var stderr bytes.Buffer
+	if err := c.Run(script, file, nil, &stderr); err != nil {
+		return fmt.Errorf("failed to send %s: %s", f.name, commandError(err, stderr.Bytes()))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+//go:build !windows
+// +build !windows
+
+package remote
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClientSync(t *testing.T) {
+	srv, conf, cleanup := testServer(t)
+	defer cleanup()
+
+	local, err := ioutil.TempDir("", "glorious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+
+	files := map[string]string{
+		"index.js":                 "console.log('hi')",
+		"lib/util.js":              "module.exports = {}",
+		"node_modules/dep/main.js": "ignored",
+	}
+	for name, contents := range files {
+		p := filepath.Join(local, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(local, "run.sh"), []byte("#!/bin/sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		c       = Get(conf)
+		exclude = []string{"node_modules"}
+		remote  = filepath.Join(srv.Home, "app")
+	)
+
+	var tests = []struct {
+		change   func()
+		local    string
+		expected []string
+	}{
+		{
+			func() {},
+			local,
+			[]string{"index.js", "lib/util.js", "run.sh"},
+		},
+		// Nothing has changed, so nothing needs sending.
+		{func() {}, local, nil},
+		{
+			func() {
+				ioutil.WriteFile(filepath.Join(local, "lib/util.js"), []byte("changed"), 0644)
+			},
+			local,
+			[]string{"lib/util.js"},
+		},
+		// Files that have been changed on the remote host are sent again.
+		{
+			func() {
+				ioutil.WriteFile(filepath.Join(remote, "index.js"), []byte("changed"), 0644)
+			},
+			filepath.Join(local, "index.js"),
+			[]string{"index.js"},
+		},
+	}
+
+	for i, test := range tests {
+		test.change()
+
+		dest := "~/app"
+		if test.local != local {
+			dest += "/" + filepath.Base(test.local)
+		}
+
+		sent, err := c.Sync(test.local, dest, exclude)
+		if err != nil {
+			t.Fatalf("[test %d] unexpected error: %s\n", i, err)
+		} else if !reflect.DeepEqual(sent, test.expected) {
+			t.Errorf("[test %d] expected %q to be sent, got %q\n", i, test.expected, sent)
+		}
+	}
+
+	for _, name := range []string{"index.js", "lib/util.js", "run.sh"} {
+		expected, _ := ioutil.ReadFile(filepath.Join(local, name))
+		got, err := ioutil.ReadFile(filepath.Join(remote, name))
+		if err != nil {
+			t.Error(err)
+		} else if string(got) != string(expected) {
+			t.Errorf("expected %s to contain %q, got %q\n", name, expected, got)
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(remote, "run.sh")); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0755 {
+		t.Error("expected run.sh to be executable, got: ", info.Mode())
+	}
+	if _, err := os.Stat(filepath.Join(remote, "node_modules")); !os.IsNotExist(err) {
+		t.Error("expected node_modules to be excluded")
+	}
+}
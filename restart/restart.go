@@ -0,0 +1,113 @@
+// Package restart implements the restart policies that can be defined on a
+// unit or slot.
+package restart
+
+import (
+	"time"
+
+	gerrors "github.com/ttacon/glorious/errors"
+)
+
+// The supported restart policies.
+const (
+	PolicyNo        = "no"
+	PolicyOnFailure = "on-failure"
+	PolicyAlways    = "always"
+)
+
+const (
+	defaultBackoff    = time.Second
+	defaultMaxBackoff = time.Minute
+)
+
+// Policy is the `restart` block of a unit or slot.
+type Policy struct {
+	// Policy is one of no, on-failure or always.
+	Policy string `hcl:"policy"`
+
+	// MaxRetries is the number of times the unit is restarted before
+	// we give up, zero means there is no limit.
+	MaxRetries int `hcl:"max_retries"`
+
+	// Backoff is the delay before the first restart, it doubles for each
+	// restart after that up until MaxBackoff.
+	Backoff    string `hcl:"backoff"`
+	MaxBackoff string `hcl:"max_backoff"`
+}
+
+func (p *Policy) Validate() []error {
+	var errs []error
+	switch p.Policy {
+	case PolicyNo, PolicyOnFailure, PolicyAlways:
+	default:
+		errs = append(errs, gerrors.ErrRestartUnknownPolicy)
+	}
+
+	if p.MaxRetries < 0 {
+		errs = append(errs, gerrors.ErrRestartNegativeMaxRetries)
+	}
+
+	if _, err := parseDuration(p.Backoff, 0); err != nil {
+		errs = append(errs, gerrors.ErrRestartInvalidBackoff)
+	}
+	if _, err := parseDuration(p.MaxBackoff, 0); err != nil {
+		errs = append(errs, gerrors.ErrRestartInvalidMaxBackoff)
+	}
+
+	return errs
+}
+
+func parseDuration(raw string, def time.Duration) (time.Duration, error) {
+	if len(raw) == 0 {
+		return def, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+func (p *Policy) backoff() time.Duration {
+	d, err := parseDuration(p.Backoff, defaultBackoff)
+	if err != nil || d <= 0 {
+		return defaultBackoff
+	}
+	return d
+}
+
+func (p *Policy) maxBackoff() time.Duration {
+	d, err := parseDuration(p.MaxBackoff, defaultMaxBackoff)
+	if err != nil || d <= 0 {
+		return defaultMaxBackoff
+	}
+	return d
+}
+
+// ShouldRestart returns whether a unit that exited with the given exit code,
+// having already been restarted restarts times, should be restarted.
+func (p *Policy) ShouldRestart(exitCode, restarts int) bool {
+	if p.MaxRetries > 0 && restarts >= p.MaxRetries {
+		return false
+	}
+
+	switch p.Policy {
+	case PolicyAlways:
+		return true
+	case PolicyOnFailure:
+		return exitCode != 0
+	}
+	return false
+}
+
+// Delay returns how long to wait before restarting a unit that has already
+// been restarted restarts times.
+func (p *Policy) Delay(restarts int) time.Duration {
+	var (
+		delay = p.backoff()
+		max   = p.maxBackoff()
+	)
+	for i := 0; i < restarts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
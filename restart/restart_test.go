@@ -0,0 +1,75 @@
+package restart
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	gerrors "github.com/ttacon/glorious/errors"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	var tests = []struct {
+		policy       Policy
+		expectedErrs []error
+	}{
+		{Policy{Policy: "always"}, nil},
+		{Policy{Policy: "on-failure", MaxRetries: 3, Backoff: "500ms"}, nil},
+		{Policy{Policy: "sometimes"}, []error{gerrors.ErrRestartUnknownPolicy}},
+		{Policy{}, []error{gerrors.ErrRestartUnknownPolicy}},
+		{Policy{Policy: "no", MaxRetries: -1}, []error{gerrors.ErrRestartNegativeMaxRetries}},
+		{Policy{Policy: "always", Backoff: "soon"}, []error{gerrors.ErrRestartInvalidBackoff}},
+		{Policy{Policy: "always", MaxBackoff: "forever"}, []error{gerrors.ErrRestartInvalidMaxBackoff}},
+	}
+
+	for i, test := range tests {
+		errs := test.policy.Validate()
+		if !reflect.DeepEqual(errs, test.expectedErrs) {
+			t.Errorf("[test %d] expected validation errors %v, got: %v\n", i, test.expectedErrs, errs)
+		}
+	}
+}
+
+func TestPolicyShouldRestart(t *testing.T) {
+	var tests = []struct {
+		policy   Policy
+		exitCode int
+		restarts int
+		expected bool
+	}{
+		{Policy{Policy: "no"}, 1, 0, false},
+		{Policy{Policy: "on-failure"}, 1, 0, true},
+		{Policy{Policy: "on-failure"}, -1, 0, true},
+		{Policy{Policy: "on-failure"}, 0, 0, false},
+		{Policy{Policy: "always"}, 0, 0, true},
+		{Policy{Policy: "always"}, 0, 100, true},
+		{Policy{Policy: "always", MaxRetries: 3}, 0, 2, true},
+		{Policy{Policy: "always", MaxRetries: 3}, 0, 3, false},
+	}
+
+	for i, test := range tests {
+		if got := test.policy.ShouldRestart(test.exitCode, test.restarts); got != test.expected {
+			t.Errorf("[test %d] expected %v, got %v\n", i, test.expected, got)
+		}
+	}
+}
+
+func TestPolicyDelay(t *testing.T) {
+	var tests = []struct {
+		policy   Policy
+		restarts int
+		expected time.Duration
+	}{
+		{Policy{}, 0, time.Second},
+		{Policy{}, 3, 8 * time.Second},
+		{Policy{}, 10, time.Minute},
+		{Policy{Backoff: "100ms", MaxBackoff: "1s"}, 1, 200 * time.Millisecond},
+		{Policy{Backoff: "100ms", MaxBackoff: "1s"}, 4, time.Second},
+	}
+
+	for i, test := range tests {
+		if got := test.policy.Delay(test.restarts); got != test.expected {
+			t.Errorf("[test %d] expected %s, got %s\n", i, test.expected, got)
+		}
+	}
+}
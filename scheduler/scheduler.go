@@ -0,0 +1,178 @@
+// Package scheduler starts units concurrently, following their dependency
+// graph.
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ttacon/glorious/unit"
+)
+
+// DefaultConcurrency is the number of units started at once when no limit
+// is configured.
+const DefaultConcurrency = 4
+
+// The states a unit moves through while being started.
+const (
+	StateQueued   = "queued"
+	StateWaiting  = "waiting"
+	StateStarting = "starting"
+	StateStarted  = "started"
+	StateRunning  = "running"
+	StateFailed   = "failed"
+	StateSkipped  = "skipped"
+)
+
+// Event is a progress update for a single unit.
+type Event struct {
+	Unit    string
+	State   string
+	Message string
+	Time    time.Time
+}
+
+// Done returns whether the event is the last one for its unit.
+func (e Event) Done() bool {
+	switch e.State {
+	case StateStarted, StateRunning, StateFailed, StateSkipped:
+		return true
+	}
+	return false
+}
+
+// Reporter is called with each progress update, it may be called from
+// several goroutines at once.
+type Reporter func(Event)
+
+// Options controls how units are started.
+type Options struct {
+	// Concurrency is the number of units that are started at once, it
+	// defaults to DefaultConcurrency.
+	Concurrency int
+
+	// ForceRecreate starts units again even if they're already running
+	// and up to date, replacing their containers.
+	ForceRecreate bool
+}
+
+type result struct {
+	done chan struct{}
+	err  error
+}
+
+// Start starts the units along with their dependencies. Each unit is started
+// as soon as its dependencies are up, so independent branches of the
+// dependency graph start at the same time, but no more than concurrency
+// units are started at once. Dependencies that were not asked for and are
+// already running are left alone, and units whose dependencies failed are
+// skipped.
+//
+// An error is returned if any unit failed to start.
+func Start(units []*unit.Unit, opts Options, report Reporter) error {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	if report == nil {
+		report = func(Event) {}
+	}
+
+	var (
+		order     = unit.StartOrder(units)
+		requested = make(map[*unit.Unit]bool)
+		results   = make(map[*unit.Unit]*result)
+		sem       = make(chan struct{}, concurrency)
+	)
+	for _, u := range units {
+		requested[u] = true
+	}
+	for _, u := range order {
+		results[u] = &result{done: make(chan struct{})}
+	}
+
+	emit := func(u *unit.Unit, state, msg string) {
+		report(Event{
+			Unit:    u.Name,
+			State:   state,
+			Message: msg,
+			Time:    time.Now(),
+		})
+	}
+
+	for _, u := range order {
+		emit(u, StateQueued, "")
+	}
+
+	for _, u := range order {
+		go func(u *unit.Unit, res *result) {
+			defer close(res.done)
+
+			for _, dep := range u.DependsOn {
+				depRes := results[dep]
+				<-depRes.done
+
+				if depRes.err != nil {
+					res.err = fmt.Errorf("dependency %q failed to start", dep.Name)
+					emit(u, StateSkipped, res.err.Error())
+					return
+				}
+			}
+
+			if !requested[u] && u.IsRunning() {
+				emit(u, StateRunning, "already running")
+				return
+			}
+
+			// Units that were asked for are only started again if
+			// they're out of date, or are being recreated.
+			if requested[u] && !opts.ForceRecreate {
+				if upToDate, err := u.IsUpToDate(); err == nil && upToDate {
+					emit(u, StateRunning, "already running")
+					return
+				}
+			}
+
+			if len(u.Dependencies) > 0 {
+				emit(u, StateWaiting, "waiting for dependencies")
+				if res.err = u.WaitForDependencies(); res.err != nil {
+					emit(u, StateFailed, res.err.Error())
+					return
+				}
+			}
+
+			sem <- struct{}{}
+			emit(u, StateStarting, "")
+			u.SetProgressReporter(func(msg string) {
+				emit(u, StateStarting, msg)
+			})
+			if opts.ForceRecreate {
+				res.err = u.RecreateSlot()
+			} else {
+				res.err = u.StartSlot()
+			}
+			u.SetProgressReporter(nil)
+			<-sem
+
+			if res.err != nil {
+				emit(u, StateFailed, res.err.Error())
+				return
+			}
+			emit(u, StateStarted, "")
+		}(u, results[u])
+	}
+
+	var failed int
+	for _, u := range order {
+		res := results[u]
+		<-res.done
+		if res.err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d units failed to start", failed, len(order))
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package scheduler
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	gcontext "github.com/ttacon/glorious/context"
+	"github.com/ttacon/glorious/provider"
+	"github.com/ttacon/glorious/slot"
+	"github.com/ttacon/glorious/status"
+	"github.com/ttacon/glorious/store"
+	"github.com/ttacon/glorious/unit"
+)
+
+type testContext struct {
+	lgr gcontext.Logger
+}
+
+func (c testContext) InternalStore() *store.Store { return store.NewStore() }
+func (c testContext) Logger() gcontext.Logger     { return c.lgr }
+
+// testDriver pretends to take a while to start units, keeping track of how
+// many are starting at once.
+type testDriver struct {
+	mux       sync.Mutex
+	active    int
+	maxActive int
+	started   map[string]time.Time
+	recreated map[string]bool
+}
+
+func (d *testDriver) Start(p *provider.Provider, u provider.Unit) error {
+	d.mux.Lock()
+	d.active++
+	if d.active > d.maxActive {
+		d.maxActive = d.active
+	}
+	d.mux.Unlock()
+
+	u.ReportProgress("pulling " + u.GetName())
+	time.Sleep(50 * time.Millisecond)
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.active--
+
+	if u.GetName() == "broken" {
+		return errors.New("broken")
+	}
+	d.started[u.GetName()] = time.Now()
+	d.recreated[u.GetName()] = u.ForceRecreate()
+	u.SetRunningStatus(status.NewRunningStatus(nil, nil), nil)
+	return nil
+}
+func (d *testDriver) Stop(p *provider.Provider, u provider.Unit) error { return nil }
+func (d *testDriver) Status(p *provider.Provider, u provider.Unit) (*status.Status, error) {
+	return u.GetStatus(), nil
+}
+func (d *testDriver) Logs(
+	p *provider.Provider,
+	u provider.Unit,
+	opts provider.LogOptions,
+	dataChan chan []byte,
+) (func(), error) {
+	return func() {}, nil
+}
+func (d *testDriver) Validate(p *provider.Provider) []error { return nil }
+
+var driver = &testDriver{
+	started:   make(map[string]time.Time),
+	recreated: make(map[string]bool),
+}
+
+func init() {
+	provider.Register("test/scheduler", driver)
+}
+
+func testUnit(name string, deps ...*unit.Unit) *unit.Unit {
+	lgr := logrus.New()
+	lgr.SetLevel(logrus.PanicLevel)
+
+	u := &unit.Unit{
+		Name: name,
+		Slots: []slot.Slot{{
+			Provider: &provider.Provider{Type: "test/scheduler"},
+		}},
+		Context: testContext{lgr: lgr},
+	}
+	for _, dep := range deps {
+		u.DependsOn = append(u.DependsOn, dep)
+		u.Dependencies = append(u.Dependencies, &unit.Dependency{
+			Name:      dep.Name,
+			Condition: unit.ConditionRunning,
+			Unit:      dep,
+		})
+	}
+	return u
+}
+
+func TestStart(t *testing.T) {
+	var (
+		db       = testUnit("db")
+		cache    = testUnit("cache")
+		queue    = testUnit("queue")
+		app      = testUnit("app", db, cache)
+		broken   = testUnit("broken")
+		worker   = testUnit("worker", queue, broken)
+		eventsM  sync.Mutex
+		events   = make(map[string][]string)
+		progress = make(map[string][]string)
+	)
+
+	err := Start([]*unit.Unit{app, worker}, Options{Concurrency: 2}, func(e Event) {
+		eventsM.Lock()
+		events[e.Unit] = append(events[e.Unit], e.State)
+		if e.State == StateStarting && len(e.Message) > 0 {
+			progress[e.Unit] = append(progress[e.Unit], e.Message)
+		}
+		eventsM.Unlock()
+	})
+	if err == nil {
+		t.Error("expected an error as broken fails to start")
+	}
+
+	if driver.maxActive != 2 {
+		t.Error("expected two units to start at once, got: ", driver.maxActive)
+	}
+
+	for _, dep := range []string{"db", "cache"} {
+		if !driver.started["app"].After(driver.started[dep]) {
+			t.Errorf("expected app to start after %s", dep)
+		}
+	}
+
+	var tests = []struct {
+		unit  string
+		final string
+	}{
+		{"db", StateStarted},
+		{"cache", StateStarted},
+		{"queue", StateStarted},
+		{"app", StateStarted},
+		{"broken", StateFailed},
+		{"worker", StateSkipped},
+	}
+
+	for i, test := range tests {
+		states := events[test.unit]
+		if len(states) == 0 || states[0] != StateQueued {
+			t.Errorf("[test %d] expected %s to be queued first, got: %v", i, test.unit, states)
+			continue
+		}
+		if final := states[len(states)-1]; final != test.final {
+			t.Errorf("[test %d] expected %s to end %s, got: %v", i, test.unit, test.final, states)
+		}
+	}
+
+	// Units that start at the same time each report their own progress.
+	for _, name := range []string{"db", "cache", "queue", "app", "broken"} {
+		if expected := []string{"pulling " + name}; !reflect.DeepEqual(progress[name], expected) {
+			t.Errorf("expected %s to report %v, got %v", name, expected, progress[name])
+		}
+	}
+
+	if _, started := driver.started["worker"]; started {
+		t.Error("expected worker not to be started")
+	}
+}
+
+func TestStartForceRecreate(t *testing.T) {
+	redis := testUnit("redis")
+
+	var tests = []struct {
+		opts          Options
+		expectedErr   bool
+		expectedFinal string
+	}{
+		{Options{}, false, StateStarted},
+		// It's already running, which is fine.
+		{Options{}, false, StateRunning},
+		{Options{ForceRecreate: true}, false, StateStarted},
+	}
+
+	for i, test := range tests {
+		var final string
+		err := Start([]*unit.Unit{redis}, test.opts, func(e Event) {
+			final = e.State
+		})
+		if (err != nil) != test.expectedErr {
+			t.Errorf("[test %d] unexpected error: %v\n", i, err)
+		}
+		if final != test.expectedFinal {
+			t.Errorf("[test %d] expected redis to end %s, got %s\n", i, test.expectedFinal, final)
+		}
+	}
+
+	driver.mux.Lock()
+	defer driver.mux.Unlock()
+	if !driver.recreated["redis"] {
+		t.Error("expected redis to be recreated")
+	}
+	if redis.ForceRecreate() {
+		t.Error("expected force recreate to only last for the start")
+	}
+}
+
+func TestStartAlreadyRunning(t *testing.T) {
+	var (
+		db  = testUnit("running-db")
+		app = testUnit("running-app", db)
+	)
+	if err := Start([]*unit.Unit{db}, Options{}, nil); err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+
+	var (
+		eventsM sync.Mutex
+		final   = make(map[string]string)
+	)
+	err := Start([]*unit.Unit{db, app}, Options{}, func(e Event) {
+		eventsM.Lock()
+		final[e.Unit] = e.State
+		eventsM.Unlock()
+	})
+	if err != nil {
+		t.Fatal("expected units that are already running not to fail, got: ", err)
+	}
+
+	expected := map[string]string{
+		"running-db":  StateRunning,
+		"running-app": StateStarted,
+	}
+	if !reflect.DeepEqual(final, expected) {
+		t.Errorf("expected %v, got %v\n", expected, final)
+	}
+}
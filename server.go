@@ -2,7 +2,7 @@ package main
 
 import (
 	"bytes"
-	"log"
+	"fmt"
 	"net"
 	"net/rpc"
 	"net/rpc/jsonrpc"
@@ -15,13 +15,13 @@ import (
 func runServer(agnt *agent.Agent, addr string, lgr context.Logger) error {
 	server := rpc.NewServer()
 	server.Register(agnt)
-	listener, e := net.Listen("tcp", addr)
-	if e != nil {
-		log.Fatal("listen error:", e)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen error: %s", err)
 	}
 	for {
 		if conn, err := listener.Accept(); err != nil {
-			lgr.Fatal("accept error: " + err.Error())
+			return fmt.Errorf("accept error: %s", err)
 		} else {
 			lgr.Infof("new connection established\n")
 			handleNewConnection(
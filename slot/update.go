@@ -0,0 +1,83 @@
+package slot
+
+import (
+	"time"
+
+	"github.com/ttacon/glorious/provider"
+	"github.com/ttacon/glorious/status"
+)
+
+// WatchForUpdates starts checking for newer versions of what the unit is
+// running in the slot, if the slot has an update_policy and its driver can
+// check for them. The unit's status shows when there's an update, which
+// is then pulled or recreated with, as per the policy.
+func (s *Slot) WatchForUpdates(u UnitInterface) {
+	stat := u.GetStatus()
+	if len(s.Provider.UpdatePolicy) == 0 || stat == nil || !stat.IsRunning() {
+		return
+	}
+
+	driver, err := s.Driver()
+	if err != nil {
+		return
+	}
+	checker, ok := driver.(provider.UpdateChecker)
+	if !ok {
+		return
+	}
+
+	interval, err := s.Provider.UpdateCheckInterval()
+	if err != nil {
+		return
+	}
+	go s.watchForUpdates(u, checker, stat, interval)
+}
+
+// watchForUpdates checks for updates every interval, until the unit is no
+// longer running with stat.
+func (s *Slot) watchForUpdates(
+	u UnitInterface,
+	checker provider.UpdateChecker,
+	stat *status.Status,
+	interval time.Duration,
+) {
+	var (
+		lgr    = u.GetContext().Logger()
+		ticker = time.NewTicker(interval)
+	)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if u.GetStatus() != stat || !stat.IsRunning() {
+			return
+		}
+
+		available, err := checker.UpdateAvailable(s.Provider, u)
+		if err != nil {
+			lgr.Debugf("[unit:%q] failed to check for update, err: %s\n", u.GetName(), err)
+			continue
+		}
+
+		if available && !stat.UpdateAvailable() {
+			lgr.Infof("[unit:%q] update available\n", u.GetName())
+		}
+		stat.SetUpdateAvailable(available)
+		if !available || s.Provider.UpdatePolicy == provider.UpdatePolicyNotify {
+			continue
+		}
+
+		if err := checker.PullUpdate(s.Provider, u); err != nil {
+			lgr.Errorf("[unit:%q] failed to pull update, err: %s\n", u.GetName(), err)
+			continue
+		} else if s.Provider.UpdatePolicy != provider.UpdatePolicyRecreate {
+			continue
+		}
+
+		// Recreating the unit gives it a new status, which is watched
+		// in our place. We carry on if it's left running with this one.
+		lgr.Infof("[unit:%q] recreating with update\n", u.GetName())
+		if err := u.RecreateSlot(); err != nil {
+			lgr.Errorf("[unit:%q] failed to recreate with update, err: %s\n", u.GetName(), err)
+		}
+	}
+}
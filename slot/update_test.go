@@ -0,0 +1,137 @@
+package slot
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	gcontext "github.com/ttacon/glorious/context"
+	"github.com/ttacon/glorious/provider"
+	"github.com/ttacon/glorious/status"
+	"github.com/ttacon/glorious/store"
+)
+
+type updateDriver struct {
+	provider.Driver
+
+	// checks are each sent a channel to reply to with whether there's
+	// an update, which holds up the check until the test replies.
+	checks chan chan bool
+	pulls  int
+}
+
+func (d *updateDriver) UpdateAvailable(p *provider.Provider, u provider.Unit) (bool, error) {
+	reply := make(chan bool)
+	d.checks <- reply
+	return <-reply, nil
+}
+
+func (d *updateDriver) PullUpdate(p *provider.Provider, u provider.Unit) error {
+	d.pulls++
+	return nil
+}
+
+var testUpdateDriver = &updateDriver{checks: make(chan chan bool)}
+
+func init() {
+	provider.Register("test/update", testUpdateDriver)
+}
+
+type fakeUnit struct {
+	UnitInterface
+
+	stat      *status.Status
+	recreated chan bool
+}
+
+func (f *fakeUnit) GetName() string              { return "fake" }
+func (f *fakeUnit) GetStatus() *status.Status    { return f.stat }
+func (f *fakeUnit) GetContext() gcontext.Context { return testContext{} }
+func (f *fakeUnit) RecreateSlot() error {
+	f.stat = status.NewRunningStatus(nil, nil)
+	f.recreated <- true
+	return nil
+}
+
+type testContext struct{}
+
+func (c testContext) InternalStore() *store.Store { return nil }
+func (c testContext) Logger() gcontext.Logger {
+	lgr := logrus.New()
+	lgr.SetOutput(ioutil.Discard)
+	return lgr
+}
+
+func TestSlotWatchForUpdates(t *testing.T) {
+	var tests = []struct {
+		policy    string
+		pulls     int
+		recreated bool
+	}{
+		{provider.UpdatePolicyNotify, 0, false},
+		{provider.UpdatePolicyPull, 1, false},
+		{provider.UpdatePolicyRecreate, 1, true},
+	}
+
+	for i, test := range tests {
+		testUpdateDriver.pulls = 0
+
+		var (
+			stat = status.NewRunningStatus(nil, nil)
+			u    = &fakeUnit{stat: stat, recreated: make(chan bool, 1)}
+			s    = &Slot{Provider: &provider.Provider{
+				Type:           "test/update",
+				UpdatePolicy:   test.policy,
+				UpdateInterval: "10ms",
+			}}
+		)
+		s.WatchForUpdates(u)
+
+		reply := <-testUpdateDriver.checks
+		reply <- true
+		if test.recreated {
+			select {
+			case <-u.recreated:
+			case <-time.After(time.Second):
+				t.Fatalf("[test %d] expected the unit to be recreated\n", i)
+			}
+		} else {
+			// Once the second check has begun, the first has been
+			// acted on.
+			reply = <-testUpdateDriver.checks
+		}
+
+		if !stat.UpdateAvailable() {
+			t.Errorf("[test %d] expected the update to show in the unit's status\n", i)
+		}
+		if testUpdateDriver.pulls != test.pulls {
+			t.Errorf("[test %d] expected %d pulls, got %d\n", i, test.pulls, testUpdateDriver.pulls)
+		}
+
+		// Stopping the unit stops the watcher.
+		stat.Stop()
+		if !test.recreated {
+			reply <- false
+		}
+		select {
+		case <-testUpdateDriver.checks:
+			t.Fatalf("[test %d] expected no checks once the unit has stopped\n", i)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestSlotWatchForUpdatesWithoutPolicy(t *testing.T) {
+	var (
+		u = &fakeUnit{stat: status.NewRunningStatus(nil, nil)}
+		s = &Slot{Provider: &provider.Provider{Type: "test/update", UpdateInterval: "10ms"}}
+	)
+	s.WatchForUpdates(u)
+
+	select {
+	case <-testUpdateDriver.checks:
+		t.Error("expected no checks without an update_policy")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -13,6 +13,23 @@ type Status struct {
 	Cmd           *exec.Cmd
 	OutFile       *os.File
 
+	// HealthErr is the error from the most recent failing health check,
+	// if the unit is unhealthy.
+	HealthErr string
+
+	// Exited is set once the command has exited, at which point ExitCode
+	// is its exit code. Both are carried over when a unit is restarted.
+	Exited   bool
+	ExitCode int
+
+	// Restarts is the number of times the unit has been restarted since
+	// it was last started by hand.
+	Restarts int
+
+	// updateAvailable is set once there's a newer version of what the
+	// unit is running, see the slot's update_policy.
+	updateAvailable bool
+
 	shutdownRequested *abool.AtomicBool
 	lock              *sync.Mutex
 }
@@ -37,9 +54,15 @@ const (
 	Running
 	Stopped
 	Crashed
+
+	// Starting, Healthy and Unhealthy are used in place of Running for
+	// units with a health check.
+	Starting
+	Healthy
+	Unhealthy
 )
 
-func (s Status) String() string {
+func (s *Status) String() string {
 	var status string
 	switch s.CurrentStatus {
 	case NotStarted:
@@ -50,10 +73,62 @@ func (s Status) String() string {
 		status = "stopped"
 	case Crashed:
 		status = "crashed"
+	case Starting:
+		status = "starting"
+	case Healthy:
+		status = "healthy"
+	case Unhealthy:
+		status = "unhealthy"
 	}
 	return status
 }
 
+// IsRunning returns whether the unit is running, regardless of its health.
+func (s *Status) IsRunning() bool {
+	switch s.CurrentStatus {
+	case Running, Starting, Healthy, Unhealthy:
+		return true
+	}
+	return false
+}
+
+// SetHealth records the result of a health check. It is a no-op if the
+// unit is no longer running, which is checked under the lock so that a check
+// finishing as the command ends can't mark it as running again.
+func (s *Status) SetHealth(health UnitStatus, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.IsRunning() {
+		return
+	}
+
+	s.CurrentStatus = health
+	if err != nil {
+		s.HealthErr = err.Error()
+	} else {
+		s.HealthErr = ""
+	}
+}
+
+// SetUpdateAvailable records whether there's a newer version of what the unit
+// is running.
+func (s *Status) SetUpdateAvailable(available bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.updateAvailable = available
+}
+
+// UpdateAvailable returns whether there's a newer version of what the unit is
+// running.
+func (s *Status) UpdateAvailable() bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.updateAvailable
+}
+
 func (s *Status) Lock() {
 	s.lock.Lock()
 }
@@ -67,21 +142,42 @@ func (s *Status) Stop() {
 	s.shutdownRequested.Set()
 }
 
+// WaitForCommandEnd waits for the command to exit and records how it went.
 func (s *Status) WaitForCommandEnd() {
-	if err := s.Cmd.Wait(); err != nil {
-		s.CurrentStatus = Crashed
-		s.Lock()
-		s.Cmd = nil
-		s.Unlock()
+	err := s.Cmd.Wait()
+
+	exitCode := -1
+	if state := s.Cmd.ProcessState; state != nil {
+		exitCode = state.ExitCode()
 	}
+	s.CommandEnded(exitCode, err != nil)
+}
 
-	s.shutdownRequested.UnSet()
+// CommandEnded records that the command has exited. Commands that we asked
+// to stop, or that didn't fail, are Stopped, any others have Crashed.
+func (s *Status) CommandEnded(exitCode int, failed bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.Exited = true
+	s.ExitCode = exitCode
+
+	if failed && !s.shutdownRequested.IsSet() {
+		s.CurrentStatus = Crashed
+	} else {
+		s.CurrentStatus = Stopped
+	}
+	s.Cmd = nil
 }
 
 func (s *Status) MarkShutdownRequested() {
 	s.shutdownRequested.Set()
 }
 
+func (s *Status) ShutdownRequested() bool {
+	return s.shutdownRequested.IsSet()
+}
+
 func (s *Status) ClearShutdown() {
 	s.shutdownRequested.UnSet()
 }
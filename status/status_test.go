@@ -0,0 +1,33 @@
+package status
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestStatusSetHealthAfterCommandEnded(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		var (
+			stat = NewRunningStatus(nil, nil)
+			wg   sync.WaitGroup
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			stat.CommandEnded(1, true)
+		}()
+		go func() {
+			defer wg.Done()
+			stat.SetHealth(Unhealthy, errors.New("connection refused"))
+		}()
+		wg.Wait()
+
+		stat.Lock()
+		current := stat.CurrentStatus
+		stat.Unlock()
+		if current != Crashed {
+			t.Fatalf("[test %d] expected a crashed unit to stay crashed, got %s\n", i, stat)
+		}
+	}
+}
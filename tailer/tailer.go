@@ -1,16 +1,32 @@
 package tailer
 
 import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/ttacon/glorious/agent"
+	"github.com/ttacon/glorious/provider"
 )
 
 type Tailer interface {
 	Handle(conn net.Conn)
 }
 
+// Line is a single frame written back to a tailing client. Frames are JSON
+// encoded, one per line. A frame with EOF set marks the end of the stream
+// for that unit.
+type Line struct {
+	Unit string    `json:"unit"`
+	Time time.Time `json:"time"`
+	Text string    `json:"text,omitempty"`
+	Err  string    `json:"err,omitempty"`
+	EOF  bool      `json:"eof,omitempty"`
+}
+
 type tailer struct {
 	agnt *agent.Agent
 }
@@ -29,54 +45,119 @@ func (t *tailer) Handle(conn net.Conn) {
 	lgr := t.agnt.Logger()
 	// First off the wire will be the token session UUID
 	var uuidBuf = make([]byte, 36)
-	n, err := conn.Read(uuidBuf)
-	if err != nil {
-		lgr.Error("failed to read uuid buffer, err: ", err)
-		closeConn()
-		return
-	} else if n != 36 {
-		lgr.Error("failed to read all 16 bytes for uuid buffer, err: ", err)
+	if n, err := io.ReadFull(conn, uuidBuf); err != nil {
+		lgr.Errorf("failed to read uuid buffer (read %d of 36 bytes), err: %s", n, err)
 		closeConn()
 		return
 	}
 
 	token := string(uuidBuf)
-	names, ok := t.agnt.ExchangeTailToken(token)
+	names, opts, ok := t.agnt.ExchangeTailToken(token)
 	if !ok {
 		lgr.Error("tail token was not found, token: ", token)
 		closeConn()
 		return
 	}
 
-	closeChan := make(chan string, len(names))
-	dataChan := make(chan []byte, len(names)*5)
-	shutdownChan := make(chan struct{}, len(names))
+	dataChan := make(chan Line, len(names)*5)
+	shutdownChan := make(chan struct{})
+
+	var shutdownOnce sync.Once
+	shutdown := func() {
+		shutdownOnce.Do(func() {
+			close(shutdownChan)
+		})
+	}
+	defer shutdown()
+	defer closeConn()
+
+	// The client never sends anything after the token, so the read only
+	// returns once the client has gone away.
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, conn)
+		lgr.Debug("tail client disconnected")
+		shutdown()
+	}()
 
 	for _, name := range names {
-		t.streamFor(name, dataChan, shutdownChan, closeChan)
+		go t.streamFor(name, opts, dataChan, shutdownChan)
 	}
 
-	// Read from dataChan
+	enc := json.NewEncoder(conn)
+	for remaining := len(names); remaining > 0; {
+		var line Line
+		select {
+		case <-shutdownChan:
+			return
+		case line = <-dataChan:
+		}
 
-	// moar?
+		// Each unit's EOF comes after the last of its lines, so once
+		// every unit has sent one there's nothing left to send.
+		if line.EOF {
+			remaining--
+		}
+		if err := enc.Encode(line); err != nil {
+			lgr.Debug("failed to write tail line, closing, err: ", err)
+			return
+		}
+	}
 }
 
 func (t *tailer) streamFor(
 	name string,
-	dataChan chan []byte,
+	opts provider.LogOptions,
+	dataChan chan Line,
 	shutdownChan chan struct{},
-	closeChan chan string,
 ) {
-	//	stopFn, err := t.agnt.Config() // stopped here
+	send := func(line Line) {
+		select {
+		case dataChan <- line:
+		case <-shutdownChan:
+		}
+	}
+	defer func() {
+		send(Line{Unit: name, Time: time.Now(), EOF: true})
+	}()
+
+	u, ok := t.agnt.Conf().GetUnit(name)
+	if !ok {
+		send(Line{Unit: name, Time: time.Now(), Err: "unknown unit"})
+		return
+	}
+
+	unitData := make(chan []byte, 5)
+	stopFn, err := u.TailWithChan(opts, unitData)
+	if err != nil {
+		send(Line{Unit: name, Time: time.Now(), Err: err.Error()})
+		return
+	}
+	defer stopFn()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-shutdownChan:
-			closeChan <- name
+			// Nobody is listening anymore, but the unit's output
+			// still has to be read for its channel to be closed.
+			go func() {
+				for range unitData {
+				}
+			}()
 			return
-		case <-time.After(time.Second):
-			// Get data!!!!
-
+		case data, ok := <-unitData:
+			if !ok {
+				return
+			}
+			send(Line{Unit: name, Time: time.Now(), Text: string(data)})
+		case <-ticker.C:
+			if !u.IsRunning() {
+				// Stop following, anything left in the channel is
+				// still sent before it closes.
+				stopFn()
+			}
 		}
 	}
 }
@@ -0,0 +1,235 @@
+package tailer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ttacon/glorious/agent"
+	"github.com/ttacon/glorious/config"
+	"github.com/ttacon/glorious/context"
+	"github.com/ttacon/glorious/provider"
+	"github.com/ttacon/glorious/status"
+)
+
+// testDriver gives each unit a running status and numLines lines of output,
+// and keeps following until it's stopped if asked to.
+type testDriver struct {
+	numLines int
+
+	mux     sync.Mutex
+	stats   map[string]*status.Status
+	stopped chan string
+}
+
+var driver = &testDriver{
+	numLines: 20,
+	stats:    make(map[string]*status.Status),
+	stopped:  make(chan string, 10),
+}
+
+func init() {
+	provider.Register("test/tail", driver)
+}
+
+func (d *testDriver) Start(p *provider.Provider, u provider.Unit) error { return nil }
+func (d *testDriver) Stop(p *provider.Provider, u provider.Unit) error  { return nil }
+func (d *testDriver) Validate(p *provider.Provider) []error             { return nil }
+
+func (d *testDriver) Status(p *provider.Provider, u provider.Unit) (*status.Status, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	stat, ok := d.stats[u.GetName()]
+	if !ok {
+		stat = status.NewRunningStatus(nil, nil)
+		d.stats[u.GetName()] = stat
+	}
+	return stat, nil
+}
+
+func (d *testDriver) Logs(
+	p *provider.Provider,
+	u provider.Unit,
+	opts provider.LogOptions,
+	dataChan chan []byte,
+) (func(), error) {
+	done := make(chan struct{})
+	go func() {
+		defer close(dataChan)
+		for i := 0; i < d.numLines; i++ {
+			dataChan <- []byte(fmt.Sprintf("%s %d", u.GetName(), i))
+		}
+		if opts.Follow {
+			<-done
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			if opts.Follow {
+				d.stopped <- u.GetName()
+			}
+		})
+	}, nil
+}
+
+const testConfig = `
+unit "api" {
+  name = "api"
+  slot "dev" {
+    provider {
+      type = "test/tail"
+    }
+  }
+}
+
+unit "db" {
+  name = "db"
+  slot "dev" {
+    provider {
+      type = "test/tail"
+    }
+  }
+}
+`
+
+// testTail starts a tail of the given units over a pipe, and returns the
+// client's end of it.
+func testTail(t *testing.T, names []string, follow bool) net.Conn {
+	conf, err := config.ParseConfigRaw([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.NewContext()
+	conf.SetContext(ctx)
+	agnt := agent.NewAgent(conf, "", ctx.Logger())
+
+	var resp agent.TailProcessesResponse
+	if err := agnt.TailProcesses(&agent.TailProcessesRequest{
+		Names:  names,
+		Follow: follow,
+	}, &resp); err != nil || len(resp.Err) > 0 {
+		t.Fatal("failed to create tail token: ", err, resp.Err)
+	}
+
+	client, server := net.Pipe()
+	go NewTailer(agnt).Handle(server)
+
+	if _, err := io.WriteString(client, resp.Token); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// readLines reads frames until the server closes the connection, pausing
+// after each one like a slow client.
+func readLines(t *testing.T, conn net.Conn) []Line {
+	var lines []Line
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var line Line
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("failed to decode frame %q: %s\n", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+		time.Sleep(time.Millisecond)
+	}
+	return lines
+}
+
+func TestTailerFraming(t *testing.T) {
+	conn := testTail(t, []string{"api"}, false)
+	defer conn.Close()
+
+	lines := readLines(t, conn)
+	if len(lines) != driver.numLines+1 {
+		t.Fatalf("expected %d frames, got %d\n", driver.numLines+1, len(lines))
+	}
+	for i, line := range lines[:driver.numLines] {
+		if expected := fmt.Sprintf("api %d", i); line.Unit != "api" ||
+			line.Text != expected || line.EOF || line.Time.IsZero() {
+			t.Errorf("[test %d] expected line %q for api, got %+v\n", i, expected, line)
+		}
+	}
+}
+
+func TestTailerEOFAfterLastLine(t *testing.T) {
+	for n := 0; n < 20; n++ {
+		conn := testTail(t, []string{"api", "db"}, false)
+
+		var (
+			lines = readLines(t, conn)
+			count = make(map[string]int)
+			eof   = make(map[string]bool)
+		)
+		for _, line := range lines {
+			if eof[line.Unit] {
+				t.Fatalf("[test %d] got %+v after %s's EOF\n", n, line, line.Unit)
+			}
+			if line.EOF {
+				eof[line.Unit] = true
+			} else {
+				count[line.Unit]++
+			}
+		}
+		conn.Close()
+
+		for _, name := range []string{"api", "db"} {
+			if count[name] != driver.numLines || !eof[name] {
+				t.Fatalf("[test %d] expected %d lines and an EOF for %s, got %d (EOF %t)\n",
+					n, driver.numLines, name, count[name], eof[name])
+			}
+		}
+	}
+}
+
+func TestTailerUnknownUnit(t *testing.T) {
+	conf, err := config.ParseConfigRaw([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.NewContext()
+	conf.SetContext(ctx)
+	token := conf.CreateTailProcessToken([]string{"missing"}, provider.LogOptions{})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go NewTailer(agent.NewAgent(conf, "", ctx.Logger())).Handle(server)
+	if _, err := io.WriteString(client, token); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readLines(t, client)
+	if len(lines) != 2 || lines[0].Err != "unknown unit" || !lines[1].EOF {
+		t.Error("expected an error and then EOF, got: ", lines)
+	}
+}
+
+func TestTailerClientDisconnect(t *testing.T) {
+	conn := testTail(t, []string{"api"}, true)
+
+	scanner := bufio.NewScanner(conn)
+	for i := 0; i < driver.numLines; i++ {
+		if !scanner.Scan() {
+			t.Fatal("expected the unit's output, got: ", scanner.Err())
+		}
+	}
+	conn.Close()
+
+	select {
+	case name := <-driver.stopped:
+		if name != "api" {
+			t.Error("expected api's logs to be stopped, got: ", name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the logs to be stopped once the client went away")
+	}
+}
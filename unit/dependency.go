@@ -0,0 +1,255 @@
+package unit
+
+import (
+	"fmt"
+	"time"
+
+	gerrors "github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/status"
+)
+
+const (
+	// ConditionStarted only requires the dependency to have been
+	// started, this is what plain `depends_on` entries use.
+	ConditionStarted = "started"
+
+	// ConditionRunning waits for the dependency to be running.
+	ConditionRunning = "running"
+
+	// ConditionHealthy waits for the dependency's health check to pass.
+	// Dependencies without a health check are healthy once running.
+	ConditionHealthy = "healthy"
+
+	defaultDependencyTimeout = time.Minute
+)
+
+var dependencyPollInterval = 250 * time.Millisecond
+
+// Dependency is a `dependency` block on a unit, it declares a dependency
+// along with what it means for the dependency to be ready.
+type Dependency struct {
+	Name      string `hcl:",key"`
+	Condition string `hcl:"condition"`
+	Timeout   string `hcl:"timeout"`
+
+	Unit *Unit
+}
+
+func (d *Dependency) condition() string {
+	if len(d.Condition) == 0 {
+		return ConditionStarted
+	}
+	return d.Condition
+}
+
+func (d *Dependency) timeout() time.Duration {
+	if timeout, err := time.ParseDuration(d.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return defaultDependencyTimeout
+}
+
+func (d *Dependency) Validate() []error {
+	var errs []error
+	switch d.condition() {
+	case ConditionStarted, ConditionRunning, ConditionHealthy:
+	default:
+		errs = append(errs, gerrors.ErrUnknownDependencyCondition)
+	}
+
+	if len(d.Timeout) > 0 {
+		if _, err := time.ParseDuration(d.Timeout); err != nil {
+			errs = append(errs, fmt.Errorf("invalid timeout: %s", err))
+		}
+	}
+	return errs
+}
+
+// ready returns whether the dependency satisfies its condition, or an error
+// if it never will.
+func (d *Dependency) ready() (bool, error) {
+	dep := d.Unit
+	if d.condition() == ConditionStarted {
+		return true, nil
+	}
+
+	// Give the provider a chance to tell us about containers that have
+	// gone away and such.
+	dep.ProcessStatus()
+
+	stat := dep.GetStatus()
+	if stat == nil {
+		return false, nil
+	}
+
+	switch stat.CurrentStatus {
+	case status.Crashed, status.Stopped:
+		return false, fmt.Errorf("dependency is %s", stat)
+	}
+
+	if d.condition() == ConditionRunning {
+		return stat.IsRunning(), nil
+	}
+
+	if dep.CurrentSlot == nil || dep.CurrentSlot.HealthCheck == nil {
+		return stat.IsRunning(), nil
+	}
+	return stat.CurrentStatus == status.Healthy, nil
+}
+
+// WaitForDependencies blocks until each of the unit's dependencies meets its
+// condition.
+func (u *Unit) WaitForDependencies() error {
+	for _, dep := range u.Dependencies {
+		if err := u.waitForDependency(dep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *Unit) waitForDependency(dep *Dependency) error {
+	lgr := u.Context.Logger()
+
+	if dep.condition() != ConditionStarted {
+		lgr.Debugf(
+			"[unit:%q] waiting up to %s for dependency %q to be %s\n",
+			u.Name,
+			dep.timeout(),
+			dep.Name,
+			dep.condition(),
+		)
+	}
+
+	deadline := time.Now().Add(dep.timeout())
+	for {
+		ready, err := dep.ready()
+		if err != nil {
+			return gerrors.DependencyErr{
+				Unit:       u.Name,
+				Dependency: dep.Name,
+				Condition:  dep.condition(),
+				Err:        err,
+			}
+		} else if ready {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			current := NOT_STARTED
+			if stat := dep.Unit.GetStatus(); stat != nil {
+				current = stat.String()
+			}
+
+			return gerrors.DependencyErr{
+				Unit:       u.Name,
+				Dependency: dep.Name,
+				Condition:  dep.condition(),
+				Err: fmt.Errorf(
+					"timed out after %s, dependency is %s",
+					dep.timeout(),
+					current,
+				),
+			}
+		}
+
+		time.Sleep(dependencyPollInterval)
+	}
+}
+
+// FindCycle returns the names of the units making up a dependency cycle, the
+// first and last names being the same unit, or nil if there are no cycles.
+func FindCycle(units []*Unit) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var (
+		state = make(map[*Unit]int)
+		stack []*Unit
+		visit func(u *Unit) []string
+	)
+	visit = func(u *Unit) []string {
+		state[u] = visiting
+		stack = append(stack, u)
+
+		for _, dep := range u.DependsOn {
+			switch state[dep] {
+			case visiting:
+				var cycle []string
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == dep {
+						for _, unit := range stack[i:] {
+							cycle = append(cycle, unit.Name)
+						}
+						break
+					}
+				}
+				return append(cycle, dep.Name)
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[u] = visited
+		return nil
+	}
+
+	for _, u := range units {
+		if state[u] == unvisited {
+			if cycle := visit(u); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// StartOrder returns the units along with all of their dependencies, ordered
+// so that every unit comes after its dependencies.
+func StartOrder(units []*Unit) []*Unit {
+	var (
+		seen  = make(map[*Unit]bool)
+		order []*Unit
+		visit func(u *Unit)
+	)
+	visit = func(u *Unit) {
+		if seen[u] {
+			return
+		}
+		seen[u] = true
+
+		for _, dep := range u.DependsOn {
+			visit(dep)
+		}
+		order = append(order, u)
+	}
+
+	for _, u := range units {
+		visit(u)
+	}
+	return order
+}
+
+// StopOrder returns the units ordered so that every unit comes before the
+// units it depends on, so dependents are stopped first.
+func StopOrder(units []*Unit) []*Unit {
+	var requested = make(map[*Unit]bool)
+	for _, u := range units {
+		requested[u] = true
+	}
+
+	var order []*Unit
+	startOrder := StartOrder(units)
+	for i := len(startOrder) - 1; i >= 0; i-- {
+		if requested[startOrder[i]] {
+			order = append(order, startOrder[i])
+		}
+	}
+	return order
+}
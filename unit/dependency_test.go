@@ -0,0 +1,92 @@
+package unit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	gerrors "github.com/ttacon/glorious/errors"
+)
+
+func TestWaitForDependency(t *testing.T) {
+	oldInterval := dependencyPollInterval
+	dependencyPollInterval = 5 * time.Millisecond
+	defer func() {
+		dependencyPollInterval = oldInterval
+	}()
+
+	var tests = []struct {
+		// setup leaves the dependency in the state being tested.
+		setup       func(dep *Unit) error
+		condition   string
+		expectedErr string
+	}{
+		// Dependencies that never start are given up on...
+		{
+			setup:       func(dep *Unit) error { return nil },
+			condition:   ConditionRunning,
+			expectedErr: "timed out after 50ms, dependency is not started",
+		},
+		// ...and those that crash aren't waited for.
+		{
+			setup: func(dep *Unit) error {
+				if err := dep.StartSlot(); err != nil {
+					return err
+				}
+				crash(dep)
+				return nil
+			},
+			condition:   ConditionHealthy,
+			expectedErr: "dependency is crashed",
+		},
+		{
+			setup:     func(dep *Unit) error { return dep.StartSlot() },
+			condition: ConditionRunning,
+		},
+	}
+
+	for i, test := range tests {
+		driver.reset(0)
+
+		dep := testUnit("db", nil)
+		if err := test.setup(dep); err != nil {
+			t.Fatalf("[test %d] failed to set up dependency: %s\n", i, err)
+		}
+
+		u := testUnit("api", nil)
+		dependency := &Dependency{
+			Name:      "db",
+			Condition: test.condition,
+			Timeout:   "50ms",
+			Unit:      dep,
+		}
+
+		start := time.Now()
+		err := u.waitForDependency(dependency)
+		if len(test.expectedErr) == 0 {
+			if err != nil {
+				t.Errorf("[test %d] expected no error, got: %s\n", i, err)
+			}
+			continue
+		}
+
+		depErr, ok := err.(gerrors.DependencyErr)
+		if !ok {
+			t.Errorf("[test %d] expected a dependency error, got: %v\n", i, err)
+			continue
+		}
+		if depErr.Unit != "api" || depErr.Dependency != "db" ||
+			depErr.Condition != test.condition {
+			t.Errorf("[test %d] expected api's dependency on db, got: %+v\n", i, depErr)
+		}
+		if depErr.Err == nil || depErr.Err.Error() != test.expectedErr {
+			t.Errorf("[test %d] expected %q, got: %v\n", i, test.expectedErr, depErr.Err)
+		}
+		if msg := err.Error(); !strings.Contains(msg, `"api"`) || !strings.Contains(msg, `"db"`) {
+			t.Errorf("[test %d] expected the error to name both units, got: %s\n", i, msg)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("[test %d] expected to stop waiting promptly, took %s\n", i, elapsed)
+		}
+	}
+}
@@ -1,20 +1,20 @@
 package unit
 
 import (
-	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
-	"strings"
+	"sync"
+	"time"
 
-	"github.com/docker/docker/client"
-	"github.com/hpcloud/tail"
 	gcontext "github.com/ttacon/glorious/context"
 	gerrors "github.com/ttacon/glorious/errors"
+	"github.com/ttacon/glorious/provider"
+	"github.com/ttacon/glorious/restart"
 	"github.com/ttacon/glorious/slot"
 	"github.com/ttacon/glorious/status"
 	"github.com/ttacon/glorious/store"
@@ -30,12 +30,50 @@ type Unit struct {
 	Groups      []string    `hcl:"groups"`
 	Slots       []slot.Slot `hcl:"slot"`
 
+	// RestartPolicy is used for any slot that doesn't have its own restart
+	// policy.
+	RestartPolicy *restart.Policy `hcl:"restart"`
+
 	Status      *status.Status
 	CurrentSlot *slot.Slot
 	Context     gcontext.Context
 
 	DependsOnRaw []string `hcl:"depends_on"`
 	DependsOn    []*Unit
+
+	// Dependencies holds every dependency of the unit, both those from
+	// depends_on and those from dependency blocks.
+	Dependencies []*Dependency `hcl:"dependency"`
+
+	// statusMux guards Status, which is replaced whenever the unit is
+	// started.
+	statusMux sync.Mutex
+
+	// restartMux guards restarts and pendingRestart, and is held while the
+	// unit is being restarted by its restart policy, so that a restart
+	// can't race with the unit being stopped or started by hand.
+	restartMux sync.Mutex
+
+	// restarts is the number of times the unit has been restarted by its
+	// restart policy since it was last started by hand.
+	restarts int
+
+	// pendingRestart is the restart waiting out its backoff, if any.
+	pendingRestart *time.Timer
+
+	// retired is set once the unit has been replaced by replacedBy, which
+	// is nil if the unit was removed, when the config was reloaded. See
+	// Retire.
+	retired    bool
+	replacedBy *Unit
+
+	// forceRecreate is set while the unit is being started by
+	// RecreateSlot.
+	forceRecreate bool
+
+	// progress is given the progress that the unit's driver reports, see
+	// SetProgressReporter.
+	progress func(string)
 }
 
 func (u *Unit) GetContext() gcontext.Context {
@@ -54,19 +92,19 @@ func (u *Unit) Start() error {
 	if len(u.DependsOn) > 0 {
 		for i, dependency := range u.DependsOn {
 			preambled := func(s string) string {
-				return "[unit:%d][dependency:%d]" + s
+				return "[unit:%q][dependency:%d] " + s
 			}
 
 			lgr.Debugf(
-				preambled(" checking status of dependency: %d\n"),
+				preambled("checking status of dependency: %q\n"),
 				u.Name,
 				i,
 				dependency.Name,
 			)
 
-			if dependency.HasStatus(status.Running) {
+			if dependency.IsRunning() {
 				lgr.Debugf(
-					preambled("dependency %q is running, no action"),
+					preambled("dependency %q is running, no action\n"),
 					u.Name,
 					i,
 					dependency.Name,
@@ -75,7 +113,7 @@ func (u *Unit) Start() error {
 			}
 
 			lgr.Debugf(
-				preambled("starting dependency %q"),
+				preambled("starting dependency %q\n"),
 				u.Name,
 				i,
 				dependency.Name,
@@ -84,8 +122,33 @@ func (u *Unit) Start() error {
 				return err
 			}
 		}
+
+		// Only once they've all been started do we wait for them,
+		// so that they can come up together.
+		if err := u.WaitForDependencies(); err != nil {
+			return err
+		}
 	}
 
+	return u.StartSlot()
+}
+
+// StartSlot starts the unit in its resolved slot, without starting or
+// waiting on any of its dependencies. Units that are already running are
+// only started again if their slot's config has changed since.
+func (u *Unit) StartSlot() error {
+	return u.startSlot(false)
+}
+
+// RecreateSlot is StartSlot, except that the unit is started again even if
+// it's already running and up to date.
+func (u *Unit) RecreateSlot() error {
+	return u.startSlot(true)
+}
+
+func (u *Unit) startSlot(force bool) error {
+	lgr := u.Context.Logger()
+
 	// Now, for some tomfoolery
 	lgr.Debugf("[unit:%q] identifying slot\n", u.Name)
 	slot, err := u.IdentifySlot()
@@ -93,14 +156,70 @@ func (u *Unit) Start() error {
 		return err
 	}
 
-	if u.HasStatus(status.Running) && slot == u.CurrentSlot {
-		return fmt.Errorf("%s is already running", u.Name)
+	if u.IsRunning() && slot == u.CurrentSlot {
+		if force {
+			lgr.Debugf("[unit:%q] stopping to recreate\n", u.Name)
+			if err := u.Stop(); err != nil {
+				return err
+			}
+		} else if stale, err := slot.IsStale(u); err != nil {
+			return err
+		} else if !stale {
+			return fmt.Errorf("%s is already running", u.Name)
+		} else {
+			lgr.Infof("[unit:%q] slot config has changed, recreating\n", u.Name)
+		}
 	}
 
+	// Starting by hand replaces any restart that's waiting on its
+	// backoff.
+	u.restartMux.Lock()
+	defer u.restartMux.Unlock()
+	u.cancelRestart()
+
 	lgr.Debugf("[unit:%q] starting slot %q\n", u.Name, slot.Name)
+	u.restarts = 0
+	u.forceRecreate = force
+	defer func() { u.forceRecreate = false }()
 	return slot.Start(u)
 }
 
+// IsUpToDate returns whether the unit is running in the slot that it resolves
+// to, as that slot is configured now, in which case starting it again would
+// fail.
+func (u *Unit) IsUpToDate() (bool, error) {
+	if !u.IsRunning() {
+		return false, nil
+	}
+
+	slot, err := u.IdentifySlot()
+	if err != nil || slot != u.CurrentSlot {
+		return false, err
+	}
+
+	stale, err := slot.IsStale(u)
+	return !stale, err
+}
+
+// ForceRecreate is whether the unit is being started by RecreateSlot.
+func (u *Unit) ForceRecreate() bool {
+	return u.forceRecreate
+}
+
+// SetProgressReporter sets what's given the progress that the unit's driver
+// reports while it starts the unit, such as how far along pulling an image
+// is. Progress is dropped while it's nil.
+func (u *Unit) SetProgressReporter(report func(string)) {
+	u.progress = report
+}
+
+// ReportProgress is called by drivers with progress on starting the unit.
+func (u *Unit) ReportProgress(message string) {
+	if report := u.progress; report != nil {
+		report(message)
+	}
+}
+
 func (u *Unit) Restart() error {
 	if err := u.Stop(); err != nil {
 		return err
@@ -132,27 +251,65 @@ func (u *Unit) OutputFile() (*os.File, error) {
 }
 
 func (u *Unit) SavePIDFile(c *exec.Cmd) error {
-	pid := c.Process.Pid
-	home := os.Getenv("HOME")
-	if len(home) == 0 {
-		return errors.New("cannot determine home directory")
+	fileName, err := u.pidFileName()
+	if err != nil {
+		return err
 	}
 
-	outputDir := filepath.Join(home, ".glorious", "state", "pid-files")
-
 	if err := os.MkdirAll(
-		outputDir,
+		filepath.Dir(fileName),
 		0744,
 	); err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(
-		filepath.Join(outputDir, u.Name),
-		[]byte(strconv.Itoa(pid)),
-		0644,
-	)
+	data, err := json.Marshal(provider.NewPIDFile(c))
+	if err != nil {
+		return err
+	}
 
+	return ioutil.WriteFile(fileName, data, 0644)
+}
+
+func (u *Unit) ReadPIDFile() (*provider.PIDFile, error) {
+	fileName, err := u.pidFileName()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var pidFile provider.PIDFile
+	if err := json.Unmarshal(data, &pidFile); err != nil {
+		return nil, fmt.Errorf("invalid pid file %s: %s", fileName, err)
+	}
+	return &pidFile, nil
+}
+
+func (u *Unit) RemovePIDFile() error {
+	fileName, err := u.pidFileName()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (u *Unit) pidFileName() (string, error) {
+	home := os.Getenv("HOME")
+	if len(home) == 0 {
+		return "", errors.New("cannot determine home directory")
+	}
+
+	return filepath.Join(home, ".glorious", "state", "pid-files", u.Name), nil
 }
 
 func (u *Unit) ProcessStatus() string {
@@ -162,38 +319,58 @@ func (u *Unit) ProcessStatus() string {
 		return NOT_STARTED
 	}
 
-	if strings.HasPrefix(slot.Provider.Type, "docker") {
-		u.populateDockerStatus(slot)
+	if err := u.refreshStatus(slot); err != nil {
+		u.Context.Logger().Debug("failed to refresh status: ", err)
 	}
 
-	if u.Status == nil {
+	stat := u.GetStatus()
+	if stat == nil {
 		return NOT_STARTED
 	}
-	return u.Status.String()
+	return stat.String()
 }
 
 func (u *Unit) HasStatus(status status.UnitStatus) bool {
-	return u.Status != nil && u.Status.CurrentStatus == status
+	stat := u.GetStatus()
+	return stat != nil && stat.CurrentStatus == status
+}
+
+// IsRunning returns whether the unit is running, healthy or not.
+func (u *Unit) IsRunning() bool {
+	stat := u.GetStatus()
+	return stat != nil && stat.IsRunning()
 }
 
 func (u *Unit) Stop() error {
-	if u.Status == nil {
+	// A restart that's in progress is waited for, so that what it
+	// started is stopped, and one that's waiting on its backoff is
+	// cancelled.
+	u.restartMux.Lock()
+	defer u.restartMux.Unlock()
+	u.cancelRestart()
+
+	stat := u.GetStatus()
+	if stat == nil {
 		return gerrors.ErrStopStopped
 	}
 
-	if u.HasStatus(status.Stopped) {
+	// Mark the shutdown first, so that a unit that has exited but is
+	// waiting to be restarted stays down.
+	stat.MarkShutdownRequested()
+
+	if u.HasStatus(status.Stopped) || u.CurrentSlot == nil {
 		return fmt.Errorf("%s is already stopped", u.Name)
 	}
 
-	u.Status.MarkShutdownRequested()
-
-	u.Status.Lock()
-	defer u.Status.Unlock()
+	stat.Lock()
+	defer stat.Unlock()
 
 	return u.CurrentSlot.Stop(u)
 }
 
-func (u *Unit) TailWithChan(dataChan chan []byte) (func(), error) {
+// TailWithChan sends each line of output from the unit to dataChan. The
+// returned function stops the tail, after which dataChan is closed.
+func (u *Unit) TailWithChan(opts provider.LogOptions, dataChan chan []byte) (func(), error) {
 	if u.ProcessStatus() == NOT_STARTED {
 		return nil, errors.New("cannot tail a stopped process")
 	}
@@ -203,39 +380,24 @@ func (u *Unit) TailWithChan(dataChan chan []byte) (func(), error) {
 		return nil, err
 	}
 
-	if strings.HasPrefix(slot.Provider.Type, "bash") {
-		t, err := tail.TailFile(u.Status.OutFile.Name(), tail.Config{Follow: true})
-		if err != nil {
-			return nil, err
-		}
-
-		go func() {
-			for line := range t.Lines {
-				dataChan <- []byte(line.Text)
-			}
-		}()
-
-		return func() {
-			t.Stop()
-		}, nil
-
+	driver, err := slot.Driver()
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("provider not currently supported: " + slot.Provider.Type)
+	return driver.Logs(slot.Provider, u, opts, dataChan)
 }
 
 func (u *Unit) Tail() error {
-	if u.ProcessStatus() == NOT_STARTED {
-		return errors.New("cannot tail a stopped process")
-	}
-
-	t, err := tail.TailFile(u.Status.OutFile.Name(), tail.Config{Follow: true})
+	dataChan := make(chan []byte, 5)
+	stop, err := u.TailWithChan(provider.LogOptions{Follow: true}, dataChan)
 	if err != nil {
 		return err
 	}
+	defer stop()
 
 	lgr := u.GetContext().Logger()
-	for line := range t.Lines {
-		lgr.Info(line.Text)
+	for line := range dataChan {
+		lgr.Info(string(line))
 	}
 
 	return nil
@@ -251,13 +413,7 @@ func (u *Unit) Init() error {
 		return fmt.Errorf("invalid provider for unit %q", u.Name)
 	}
 
-	if strings.HasPrefix(slot.Provider.Type, "docker") {
-		if err := u.populateDockerStatus(slot); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return u.refreshStatus(slot)
 }
 
 func (u *Unit) IdentifySlot() (*slot.Slot, error) {
@@ -306,42 +462,56 @@ func (u *Unit) IdentifySlot() (*slot.Slot, error) {
 	return defaultSlot, nil
 }
 
-func (u *Unit) populateDockerStatus(slot *slot.Slot) error {
-	isRemote := slot.Provider.Type == "docker/remote"
-
-	options := []client.Opt{
-		client.FromEnv,
-		client.WithAPIVersionNegotiation(),
-	}
-	if isRemote {
-		options = append(options, client.WithHost(slot.Provider.Remote.Host))
-	}
-	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(options...)
+// refreshStatus asks the slot's driver for the current status of the unit,
+// this picks up units that were started before we were.
+func (u *Unit) refreshStatus(slot *slot.Slot) error {
+	driver, err := slot.Driver()
 	if err != nil {
 		return err
 	}
 
-	if _, err = cli.ContainerInspect(ctx, u.Name); err != nil {
-		if client.IsErrNotFound(err) {
-			if u.Status != nil {
-				u.Status = nil
-			}
-
-			return nil
-		}
+	stat, err := driver.Status(slot.Provider, u)
+	if err != nil {
 		return err
 	}
 
-	u.CurrentSlot = slot
+	if stat == u.GetStatus() {
+		return nil
+	} else if stat == nil {
+		u.statusMux.Lock()
+		u.Status = nil
+		u.statusMux.Unlock()
+		return nil
+	}
 
-	u.SetRunningStatus(status.NewRunningStatus(nil, nil), nil)
+	u.CurrentSlot = slot
+	u.SetRunningStatus(stat, nil)
+	slot.MonitorHealth(stat)
+	slot.WatchForUpdates(u)
 
 	return nil
 }
 
 func (u *Unit) Validate() []*gerrors.ErrWithPath {
 	var unitErrs []*gerrors.ErrWithPath
+	for _, dep := range u.Dependencies {
+		for _, err := range dep.Validate() {
+			unitErrs = append(unitErrs, &gerrors.ErrWithPath{
+				Path: []string{"unit", u.Name, "dependency", dep.Name},
+				Err:  err,
+			})
+		}
+	}
+
+	if u.RestartPolicy != nil {
+		for _, err := range u.RestartPolicy.Validate() {
+			unitErrs = append(unitErrs, &gerrors.ErrWithPath{
+				Path: []string{"unit", u.Name, "restart"},
+				Err:  err,
+			})
+		}
+	}
+
 	for _, slot := range u.Slots {
 		if errs := slot.Validate(); len(errs) > 0 {
 			for _, err := range errs {
@@ -358,18 +528,177 @@ func (u *Unit) GetName() string {
 }
 
 func (u *Unit) SetRunningStatus(stat *status.Status, cb status.StatusCallback) {
+	u.statusMux.Lock()
 	u.Status = stat
-	u.Status.ClearShutdown()
+	u.statusMux.Unlock()
+	stat.ClearShutdown()
 
 	if cb != nil {
-		u.Status.Lock()
-		defer u.Status.Unlock()
+		stat.Lock()
+		defer stat.Unlock()
 
 		cb(stat)
 	}
 }
 
+// ProcessExited restarts the unit, after a backoff, if its restart policy
+// says to. Nothing is restarted once a stop has been requested, or if the
+// unit has been started again in the meantime.
+func (u *Unit) ProcessExited(stat *status.Status) {
+	u.restartMux.Lock()
+	defer u.restartMux.Unlock()
+
+	if u.retired {
+		if u.replacedBy != nil {
+			u.replacedBy.ProcessExited(stat)
+		}
+		return
+	}
+
+	slot := u.CurrentSlot
+	if slot == nil || stat.ShutdownRequested() {
+		return
+	}
+	u.scheduleRestart(slot, stat)
+}
+
+// scheduleRestart restarts the unit in slot after the backoff for its next
+// restart, if its restart policy allows another. The unit's restartMux must
+// be held.
+func (u *Unit) scheduleRestart(slot *slot.Slot, stat *status.Status) {
+	policy := slot.RestartPolicy
+	if policy == nil {
+		policy = u.RestartPolicy
+	}
+	if policy == nil || !policy.ShouldRestart(stat.ExitCode, u.restarts) {
+		return
+	}
+
+	delay := policy.Delay(u.restarts)
+	u.Context.Logger().Infof(
+		"[unit:%q] exited with code %d, restarting in %s\n",
+		u.Name,
+		stat.ExitCode,
+		delay,
+	)
+
+	u.pendingRestart = time.AfterFunc(delay, func() {
+		u.restartSlot(slot, stat)
+	})
+}
+
+// restartSlot restarts the unit in slot, after its process exited with stat,
+// unless it's been stopped or started again since. A restart that fails
+// counts towards the policy's max_retries, and is tried again after the next
+// backoff.
+func (u *Unit) restartSlot(slot *slot.Slot, stat *status.Status) {
+	u.restartMux.Lock()
+	defer u.restartMux.Unlock()
+
+	lgr := u.Context.Logger()
+
+	u.pendingRestart = nil
+	if u.retired {
+		// Retire got here first, but couldn't cancel us in time.
+		if u.replacedBy != nil {
+			u.replacedBy.ProcessExited(stat)
+		}
+		return
+	} else if stat.ShutdownRequested() || u.GetStatus() != stat {
+		lgr.Debugf("[unit:%q] no longer restarting\n", u.Name)
+		return
+	}
+
+	u.restarts++
+	if err := slot.Start(u); err != nil {
+		lgr.Errorf("[unit:%q] failed to restart: %s\n", u.Name, err)
+		if u.GetStatus() == stat {
+			u.scheduleRestart(slot, stat)
+		}
+		return
+	}
+
+	restarted := u.GetStatus()
+	restarted.Lock()
+	restarted.Restarts = u.restarts
+	restarted.Exited = stat.Exited
+	restarted.ExitCode = stat.ExitCode
+	restarted.Unlock()
+}
+
+// cancelRestart cancels the restart that's waiting on its backoff, if
+// there is one. The unit's restartMux must be held.
+func (u *Unit) cancelRestart() {
+	if u.pendingRestart != nil {
+		u.pendingRestart.Stop()
+		u.pendingRestart = nil
+	}
+}
+
+// CarryOver takes over the status of prev, the unit that this one replaces
+// when the config is reloaded, so that a unit that's already running isn't
+// found again by its driver. It's called before the unit is initialized.
+func (u *Unit) CarryOver(prev *Unit) {
+	prev.restartMux.Lock()
+	defer prev.restartMux.Unlock()
+
+	u.carryOver(prev)
+}
+
+// carryOver is CarryOver with prev's restartMux held.
+func (u *Unit) carryOver(prev *Unit) {
+	u.restartMux.Lock()
+	defer u.restartMux.Unlock()
+
+	stat := prev.GetStatus()
+	if stat == nil || prev.CurrentSlot == nil {
+		return
+	}
+
+	// The unit stays in the slot of the same name, if it still has one.
+	for i := range u.Slots {
+		if u.Slots[i].Name == prev.CurrentSlot.Name {
+			u.statusMux.Lock()
+			u.Status = stat
+			u.statusMux.Unlock()
+			u.CurrentSlot = &u.Slots[i]
+			u.restarts = prev.restarts
+			return
+		}
+	}
+}
+
+// Retire hands the unit over to next, the unit that replaces it once the
+// reloaded config is in use, or nil if the unit was removed. From then on
+// next restarts the unit when its process exits, including a restart that's
+// waiting on its backoff, so nothing is restarted behind next's back.
+func (u *Unit) Retire(next *Unit) {
+	u.restartMux.Lock()
+	defer u.restartMux.Unlock()
+
+	u.retired = true
+	u.replacedBy = next
+
+	pending := u.pendingRestart != nil && u.pendingRestart.Stop()
+	u.pendingRestart = nil
+	if next == nil {
+		return
+	}
+
+	// We may have been restarted since next was given our status.
+	stat := u.GetStatus()
+	if stat != next.GetStatus() {
+		next.carryOver(u)
+	}
+	if pending {
+		next.ProcessExited(stat)
+	}
+}
+
 func (u *Unit) GetStatus() *status.Status {
+	u.statusMux.Lock()
+	defer u.statusMux.Unlock()
+
 	return u.Status
 }
 
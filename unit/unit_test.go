@@ -0,0 +1,254 @@
+package unit
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ttacon/glorious/context"
+	"github.com/ttacon/glorious/provider"
+	"github.com/ttacon/glorious/restart"
+	"github.com/ttacon/glorious/slot"
+	"github.com/ttacon/glorious/status"
+)
+
+// testDriver runs units without running anything, failing the next
+// failStarts starts.
+type testDriver struct {
+	mux        sync.Mutex
+	starts     int
+	failStarts int
+}
+
+var driver = &testDriver{}
+
+func init() {
+	provider.Register("test/unit", driver)
+}
+
+func (d *testDriver) reset(failStarts int) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.starts = 0
+	d.failStarts = failStarts
+}
+
+func (d *testDriver) numStarts() int {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	return d.starts
+}
+
+func (d *testDriver) Start(p *provider.Provider, u provider.Unit) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.starts++
+	if d.failStarts > 0 {
+		d.failStarts--
+		return errors.New("failed to start")
+	}
+	u.SetRunningStatus(status.NewRunningStatus(nil, nil), nil)
+	return nil
+}
+
+func (d *testDriver) Stop(p *provider.Provider, u provider.Unit) error {
+	u.GetStatus().Stop()
+	return nil
+}
+
+func (d *testDriver) Status(p *provider.Provider, u provider.Unit) (*status.Status, error) {
+	return u.GetStatus(), nil
+}
+
+func (d *testDriver) Logs(
+	p *provider.Provider,
+	u provider.Unit,
+	opts provider.LogOptions,
+	dataChan chan []byte,
+) (func(), error) {
+	close(dataChan)
+	return func() {}, nil
+}
+
+func (d *testDriver) Validate(p *provider.Provider) []error { return nil }
+
+func testUnit(name string, policy *restart.Policy) *Unit {
+	return &Unit{
+		Name: name,
+		Slots: []slot.Slot{{
+			Name:     "dev",
+			Provider: &provider.Provider{Type: "test/unit"},
+		}},
+		RestartPolicy: policy,
+		Context:       context.NewContext(),
+	}
+}
+
+// crash makes the unit's process exit as if it had crashed.
+func crash(u *Unit) {
+	stat := u.GetStatus()
+	stat.CommandEnded(1, true)
+	u.ProcessExited(stat)
+}
+
+func TestUnitStopDuringBackoff(t *testing.T) {
+	driver.reset(0)
+
+	u := testUnit("app", &restart.Policy{Policy: restart.PolicyAlways, Backoff: "50ms"})
+	if err := u.StartSlot(); err != nil {
+		t.Fatal("failed to start: ", err)
+	}
+
+	crash(u)
+	if err := u.Stop(); err != nil {
+		t.Fatal("failed to stop: ", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if n := driver.numStarts(); n != 1 {
+		t.Errorf("expected the stop to cancel the restart, got %d starts\n", n)
+	}
+	if !u.HasStatus(status.Stopped) {
+		t.Error("expected the unit to stay stopped, got: ", u.ProcessStatus())
+	}
+}
+
+func TestUnitStopRacingRestart(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		driver.reset(0)
+
+		u := testUnit("app", &restart.Policy{Policy: restart.PolicyAlways, Backoff: "1ms"})
+		if err := u.StartSlot(); err != nil {
+			t.Fatal("failed to start: ", err)
+		}
+
+		crash(u)
+		time.Sleep(time.Duration(i%3) * time.Millisecond)
+		_ = u.Stop()
+
+		// Whether or not the restart got in first, nothing may be
+		// running once the stop has returned.
+		time.Sleep(10 * time.Millisecond)
+		if u.IsRunning() {
+			t.Fatalf("[test %d] expected the unit to stay stopped\n", i)
+		}
+	}
+}
+
+func TestUnitFailedRestart(t *testing.T) {
+	var tests = []struct {
+		failStarts       int
+		maxRetries       int
+		expectedStarts   int
+		expectedRunning  bool
+		expectedRestarts int
+	}{
+		// Failed restarts are retried after the next backoff...
+		{2, 0, 4, true, 3},
+		// ...but count towards max_retries.
+		{3, 2, 3, false, 0},
+	}
+
+	for i, test := range tests {
+		driver.reset(0)
+
+		u := testUnit("app", &restart.Policy{
+			Policy:     restart.PolicyOnFailure,
+			MaxRetries: test.maxRetries,
+			Backoff:    "5ms",
+			MaxBackoff: "5ms",
+		})
+		if err := u.StartSlot(); err != nil {
+			t.Fatalf("[test %d] failed to start: %s\n", i, err)
+		}
+
+		driver.reset(test.failStarts)
+		crash(u)
+		time.Sleep(100 * time.Millisecond)
+
+		if n := driver.numStarts(); n != test.expectedStarts-1 {
+			t.Errorf("[test %d] expected %d restart attempts, got %d\n", i, test.expectedStarts-1, n)
+		}
+		if u.IsRunning() != test.expectedRunning {
+			t.Errorf("[test %d] expected running %t, got %s\n", i, test.expectedRunning, u.ProcessStatus())
+		}
+		if test.expectedRunning {
+			stat := u.GetStatus()
+			stat.Lock()
+			if stat.Restarts != test.expectedRestarts {
+				t.Errorf("[test %d] expected %d restarts, got %d\n", i, test.expectedRestarts, stat.Restarts)
+			}
+			stat.Unlock()
+		}
+		_ = u.Stop()
+	}
+}
+
+func TestUnitRetire(t *testing.T) {
+	driver.reset(0)
+
+	policy := &restart.Policy{Policy: restart.PolicyAlways, Backoff: "20ms"}
+	prev := testUnit("app", policy)
+	if err := prev.StartSlot(); err != nil {
+		t.Fatal("failed to start: ", err)
+	}
+	stat := prev.GetStatus()
+
+	// A restart that's waiting on its backoff is carried out by the new
+	// unit instead.
+	crash(prev)
+	next := testUnit("app", policy)
+	next.CarryOver(prev)
+	prev.Retire(next)
+
+	time.Sleep(100 * time.Millisecond)
+	if n := driver.numStarts(); n != 2 {
+		t.Fatalf("expected the new unit to restart once, got %d starts\n", n)
+	}
+	if !next.IsRunning() || next.GetStatus() == stat {
+		t.Fatal("expected the new unit to be running, got: ", next.ProcessStatus())
+	}
+
+	// Stopping the new unit keeps it stopped, even when the old unit
+	// hears about the exit.
+	stat = next.GetStatus()
+	if err := next.Stop(); err != nil {
+		t.Fatal("failed to stop: ", err)
+	}
+	prev.ProcessExited(stat)
+
+	time.Sleep(100 * time.Millisecond)
+	if n := driver.numStarts(); n != 2 {
+		t.Errorf("expected the unit to stay stopped, got %d starts\n", n)
+	}
+	if prev.IsRunning() || next.IsRunning() {
+		t.Error("expected neither unit to be running")
+	}
+}
+
+func TestUnitCarryOver(t *testing.T) {
+	driver.reset(0)
+
+	prev := testUnit("app", nil)
+	if err := prev.StartSlot(); err != nil {
+		t.Fatal("failed to start: ", err)
+	}
+
+	next := testUnit("app", nil)
+	next.CarryOver(prev)
+	if next.GetStatus() != prev.GetStatus() || next.CurrentSlot != &next.Slots[0] {
+		t.Error("expected the running status to be carried over to the unit's slot")
+	}
+
+	// Units whose slot has gone start from scratch.
+	renamed := testUnit("app", nil)
+	renamed.Slots[0].Name = "prod"
+	renamed.CarryOver(prev)
+	if renamed.GetStatus() != nil || renamed.CurrentSlot != nil {
+		t.Error("expected nothing to be carried over to a different slot")
+	}
+}